@@ -0,0 +1,101 @@
+// Package asset implements the pieces shared by the tl commands for naming
+// downloaded assets in the asset transparency log and checking their digests
+// against the records the log returns.
+package asset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// ErrMismatch is returned when the digest of an asset does not match
+// the digest recorded in the log.
+var ErrMismatch = errors.New("digest mismatch")
+
+// Key returns the log lookup key for the asset served at rawurl.
+func Key(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q: missing host", rawurl)
+	}
+	return u.Host + u.Path, nil
+}
+
+// Digest returns the "h1:" digest string the log records for an asset
+// with the given sha256 sum.
+func Digest(sum []byte) string {
+	return "h1:" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// ValidDigest reports whether d is a well-formed "h1:" digest string,
+// as returned by Digest.
+func ValidDigest(d string) bool {
+	if !strings.HasPrefix(d, "h1:") {
+		return false
+	}
+	sum, err := base64.StdEncoding.DecodeString(d[len("h1:"):])
+	return err == nil && len(sum) == sha256.Size
+}
+
+// Sum returns the sha256 sum of the content read from r.
+func Sum(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Check checks that the record data returned by the log vouches for want,
+// which may be any digest in the record. Use Record.Newest to tell
+// whether the asset has been recorded with newer contents since.
+func Check(data []byte, want string) error {
+	rec := ParseRecord(data)
+	newest := rec.Newest()
+	switch {
+	case newest == "":
+		return fmt.Errorf("%w: no log digest for %s", ErrMismatch, want)
+	case rec.Index(want) >= 0:
+		return nil
+	}
+	return fmt.Errorf("%w: file digest %s != log digest %s", ErrMismatch, want, newest)
+}
+
+// Verify looks up the key for r in the log using client and checks that
+// the record vouches for an asset with the given sha256 sum.
+// It records the digest, the record and the tree head used in r, and
+// the newest digest in the record if it is not the one for sum.
+// The Digest field of opts is set by Verify.
+func Verify(ctx context.Context, client *sumdb.Client, r *Result, sum []byte, opts sumdb.LookupOpts) error {
+	want := Digest(sum)
+	r.Digest = want
+	opts.Digest = want
+	id, data, err := client.LookupContext(ctx, r.Key, opts)
+	if err != nil {
+		return err
+	}
+	r.RecordID = id
+	tree, msg := client.Latest()
+	r.TreeSize = tree.N
+	r.TreeHash = tree.Hash.String()
+	r.SignedNote = string(msg)
+
+	if err := Check(data, want); err != nil {
+		return err
+	}
+	if newest := ParseRecord(data).Newest(); newest != want {
+		r.NewestDigest = newest
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package asset
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// ErrUsage is wrapped by errors caused by invalid command line input.
+var ErrUsage = errors.New("usage error")
+
+// Exit codes used by the tl commands.
+// When several assets fail, the command exits with the code
+// of the most severe failure, in the order listed below.
+const (
+	ExitOK       = 0
+	ExitError    = 1 // any failure not listed below
+	ExitUsage    = 2 // invalid command line arguments
+	ExitMismatch = 3 // asset digest differs from the digest in the log
+	ExitNotFound = 4 // URL has no record in the log
+	ExitNetwork  = 5 // network failure, timeout or transient server error; retrying may help
+	ExitSecurity = 6 // log server misbehavior, such as a forked log, was detected
+	ExitRefused  = 7 // log server refused to record the URL by policy
+)
+
+// Error types reported in Error.Type, one for each exit code.
+const (
+	ErrorMismatch = "mismatch"
+	ErrorNotFound = "not-found"
+	ErrorNetwork  = "network"
+	ErrorSecurity = "security"
+	ErrorRefused  = "refused"
+	ErrorUsage    = "usage"
+	ErrorOther    = "error"
+)
+
+// severity orders the exit codes from least to most severe.
+var severity = []int{ExitOK, ExitError, ExitUsage, ExitNetwork, ExitRefused, ExitNotFound, ExitMismatch, ExitSecurity}
+
+// ErrorType returns the type of err, one of the Error constants above.
+func ErrorType(err error) string {
+	var re *sumdb.RemoteError
+	var ne net.Error
+	switch {
+	case errors.Is(err, sumdb.ErrSecurity), errors.Is(err, sumdb.ErrNotWitnessed):
+		return ErrorSecurity
+	case errors.Is(err, ErrMismatch):
+		return ErrorMismatch
+	case errors.Is(err, sumdb.ErrNotFound), errors.Is(err, sumdb.ErrOffline):
+		return ErrorNotFound
+	case errors.Is(err, sumdb.ErrRefused):
+		return ErrorRefused
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorNetwork
+	case errors.Is(err, context.Canceled):
+		return ErrorOther
+	case errors.As(err, &re) && re.Temporary(), errors.As(err, &ne):
+		return ErrorNetwork
+	case errors.Is(err, ErrUsage):
+		return ErrorUsage
+	}
+	return ErrorOther
+}
+
+// ExitCode returns the exit code for err.
+// If err is nil, ExitCode returns ExitOK.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	switch ErrorType(err) {
+	case ErrorSecurity:
+		return ExitSecurity
+	case ErrorMismatch:
+		return ExitMismatch
+	case ErrorNotFound:
+		return ExitNotFound
+	case ErrorRefused:
+		return ExitRefused
+	case ErrorNetwork:
+		return ExitNetwork
+	case ErrorUsage:
+		return ExitUsage
+	}
+	return ExitError
+}
+
+// WorstExitCode returns the most severe exit code among errs.
+func WorstExitCode(errs ...error) int {
+	rank := func(code int) int {
+		for i, c := range severity {
+			if c == code {
+				return i
+			}
+		}
+		return 0
+	}
+	worst := ExitOK
+	for _, err := range errs {
+		if code := ExitCode(err); rank(code) > rank(worst) {
+			worst = code
+		}
+	}
+	return worst
+}
+
+// Fatal prints err and exits with the exit code for err.
+func Fatal(err error) {
+	log.Print(err)
+	os.Exit(ExitCode(err))
+}
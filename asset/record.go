@@ -0,0 +1,52 @@
+package asset
+
+import "strings"
+
+// A Record is the data of a log record for an asset URL.
+//
+// The log appends a new "h1:" digest line to the record each time it
+// observes different content at the URL, so the digests are in log order,
+// oldest first. Any other non-empty lines, such as the key the record
+// was created for, are metadata.
+type Record struct {
+	Digests  []string `json:"digests"`
+	Metadata []string `json:"metadata,omitempty"`
+}
+
+// ParseRecord parses the record data returned by the log.
+func ParseRecord(data []byte) *Record {
+	rec := new(Record)
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "h1:"):
+			rec.Digests = append(rec.Digests, line)
+		default:
+			rec.Metadata = append(rec.Metadata, line)
+		}
+	}
+	return rec
+}
+
+// Newest returns the most recently recorded digest,
+// or the empty string if the record has no digests.
+func (rec *Record) Newest() string {
+	if len(rec.Digests) == 0 {
+		return ""
+	}
+	return rec.Digests[len(rec.Digests)-1]
+}
+
+// Index returns the position of digest in rec.Digests,
+// or -1 if the log has never recorded it. Content that reverts
+// to an earlier version is recorded again, so Index returns the
+// position of the most recent occurrence.
+func (rec *Record) Index(digest string) int {
+	for i := len(rec.Digests) - 1; i >= 0; i-- {
+		if rec.Digests[i] == digest {
+			return i
+		}
+	}
+	return -1
+}
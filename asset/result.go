@@ -0,0 +1,71 @@
+package asset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// A Result is the structured outcome of verifying a single asset,
+// as printed by the --output json mode of the tl commands.
+type Result struct {
+	URL    string `json:"url"`
+	Key    string `json:"key"`
+	File   string `json:"file,omitempty"`
+	Digest string `json:"digest,omitempty"` // digest computed from the asset contents
+
+	// The log record that vouched for the asset,
+	// and the signed tree head used to authenticate it.
+	RecordID   int64  `json:"record_id"`
+	TreeSize   int64  `json:"tree_size,omitempty"`
+	TreeHash   string `json:"tree_hash,omitempty"`
+	SignedNote string `json:"signed_note,omitempty"`
+
+	// NewestDigest is the newest digest in the record, if the asset
+	// matched an older one. It is a warning, not a failure.
+	NewestDigest string `json:"newest_digest,omitempty"`
+
+	Error *Error `json:"error,omitempty"`
+}
+
+// An Error describes why verifying an asset failed.
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NewResult returns a Result for the asset at rawurl.
+// If rawurl cannot be parsed, NewResult returns the Result
+// along with the parse error.
+func NewResult(rawurl string) (*Result, error) {
+	r := &Result{URL: rawurl}
+	key, err := Key(rawurl)
+	if err != nil {
+		return r, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	r.Key = key
+	return r, nil
+}
+
+// SetError records err as the reason verification failed.
+// If err is nil, SetError does nothing.
+func (r *Result) SetError(err error) {
+	if err == nil {
+		return
+	}
+	r.Error = &Error{Type: ErrorType(err), Message: err.Error()}
+}
+
+// WriteJSON writes r to w as a single line of JSON.
+func (r *Result) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// Warning returns a message saying that the asset matched an older digest
+// in its record, or "" if it matched the newest one.
+func (r *Result) Warning() string {
+	if r.NewestDigest == "" {
+		return ""
+	}
+	return fmt.Sprintf("warning: file digest %s is an older log digest, newest is %s", r.Digest, r.NewestDigest)
+}
@@ -0,0 +1,280 @@
+// Package audit replays every record of an asset transparency log,
+// recomputes the log's tree hash from the records alone, and reports
+// records that break the log's rules.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// tileHeight is the height of the record data tiles read by the auditor,
+// the same as the sumdb.Client default.
+const tileHeight = 8
+
+// Kinds of anomalies found by an audit.
+const (
+	// Malformed means a record has no key, no digests,
+	// or an "h1:" line that is not a valid digest.
+	Malformed = "malformed"
+
+	// Duplicate means a record repeats the digests of
+	// the previous record for its key without adding one.
+	Duplicate = "duplicate"
+
+	// Rewritten means a record for a key does not keep the digests of
+	// the previous record for the key in order, so the log dropped or
+	// changed history instead of appending a new digest.
+	Rewritten = "rewritten"
+)
+
+// An Anomaly is a record that breaks the log's rules.
+type Anomaly struct {
+	Kind     string `json:"kind"`
+	RecordID int64  `json:"record_id"`
+	Key      string `json:"key"`
+	Message  string `json:"message"`
+
+	// Previous is the ID of the previous record for Key,
+	// for Duplicate and Rewritten anomalies.
+	Previous int64 `json:"previous"`
+}
+
+// A Report is the result of an audit.
+type Report struct {
+	TreeSize   int64     `json:"tree_size"`
+	TreeHash   string    `json:"tree_hash"`
+	SignedNote string    `json:"signed_note"`
+	Keys       int       `json:"keys"` // distinct keys in the log
+	Anomalies  []Anomaly `json:"anomalies"`
+}
+
+// An Auditor audits the log whose tree heads are signed by any of Verifiers.
+type Auditor struct {
+	Remote    sumdb.Remote
+	Verifiers []note.Verifier
+
+	// Batch is the number of record data tiles,
+	// of 256 records each, to fetch at a time.
+	Batch int
+
+	// Progress, if not nil, is called after each batch
+	// with the number of records audited so far.
+	Progress func(done, total int64)
+}
+
+// keyState is the latest record seen for a key.
+type keyState struct {
+	id      int64
+	digests []string
+}
+
+// Audit fetches the log's latest signed tree head and every record in it.
+// It recomputes the stored hashes of each record and checks that the
+// resulting tree hash is the signed one, returning an error wrapping
+// sumdb.ErrSecurity if it is not. It reports the anomalies it finds
+// in the records, in log order.
+func (a *Auditor) Audit(ctx context.Context) (*Report, error) {
+	msg, err := a.Remote.ReadRemoteContext(ctx, "/latest", "")
+	if err != nil {
+		return nil, err
+	}
+	n, err := note.Open(msg, note.VerifierList(a.Verifiers...))
+	if err != nil {
+		return nil, fmt.Errorf("reading tree note: %w\nnote:\n%s", err, msg)
+	}
+	tree, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return nil, fmt.Errorf("reading tree: %v\ntree:\n%s", err, n.Text)
+	}
+
+	batch := a.Batch
+	if batch < 1 {
+		batch = 1
+	}
+	rep := &Report{
+		TreeSize:   tree.N,
+		TreeHash:   tree.Hash.String(),
+		SignedNote: string(msg),
+	}
+	var hashes hashList
+	keys := make(map[string]*keyState)
+
+	tiles := (tree.N + 1<<tileHeight - 1) >> tileHeight
+	for first := int64(0); first < tiles; first += int64(batch) {
+		last := first + int64(batch)
+		if last > tiles {
+			last = tiles
+		}
+		records, err := a.readRecords(ctx, first, last, tree.N)
+		if err != nil {
+			return nil, err
+		}
+		for _, text := range records {
+			id := hashes.records
+			stored, err := tlog.StoredHashesForRecordHash(id, tlog.RecordHash(text), hashes)
+			if err != nil {
+				return nil, err
+			}
+			hashes.add(stored)
+			rep.Anomalies = append(rep.Anomalies, check(keys, id, text)...)
+		}
+		if a.Progress != nil {
+			a.Progress(hashes.records, tree.N)
+		}
+	}
+
+	rep.Keys = len(keys)
+	h, err := tlog.TreeHash(tree.N, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if h != tree.Hash {
+		return rep, fmt.Errorf("%w: records hash to tree %d %v, but the log signed %v", sumdb.ErrSecurity, tree.N, h, tree.Hash)
+	}
+	return rep, nil
+}
+
+// readRecords fetches the record data tiles first through last-1
+// in parallel and returns their records, in order, up to tree size n.
+func (a *Auditor) readRecords(ctx context.Context, first, last, n int64) ([][]byte, error) {
+	data := make([][][]byte, last-first)
+	errs := make([]error, last-first)
+	var wg sync.WaitGroup
+	for i := range data {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			t := tlog.Tile{H: tileHeight, L: -1, N: first + int64(i), W: 1 << tileHeight}
+			if end := (t.N + 1) << tileHeight; end > n {
+				t.W = int(n - t.N<<tileHeight)
+			}
+			data[i], errs[i] = a.readTile(ctx, t)
+		}(i)
+	}
+	wg.Wait()
+
+	var records [][]byte
+	for i := range data {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		records = append(records, data[i]...)
+	}
+	return records, nil
+}
+
+// readTile fetches the record data tile t and returns its records.
+func (a *Auditor) readTile(ctx context.Context, t tlog.Tile) ([][]byte, error) {
+	data, err := sumdb.ReadRemoteTile(ctx, a.Remote, t)
+	if err != nil {
+		return nil, err
+	}
+
+	start := t.N << uint(t.H)
+	var records [][]byte
+	for i := 0; i < t.W; i++ {
+		id, text, rest, err := tlog.ParseRecord(data)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", t.Path(), err)
+		}
+		if id != start+int64(i) {
+			return nil, fmt.Errorf("reading %s: found record %d, want %d", t.Path(), id, start+int64(i))
+		}
+		records = append(records, text)
+		data = rest
+	}
+	return records, nil
+}
+
+// check checks record id with the given text against the rules,
+// updating keys, and returns any anomalies.
+func check(keys map[string]*keyState, id int64, text []byte) []Anomaly {
+	key := string(text)
+	if i := bytes.IndexByte(text, '\n'); i >= 0 {
+		key = string(text[:i])
+	}
+	if key == "" {
+		return []Anomaly{{Kind: Malformed, RecordID: id, Message: "record has no key"}}
+	}
+
+	var list []Anomaly
+	rec := asset.ParseRecord(text)
+	for _, d := range rec.Digests {
+		if !asset.ValidDigest(d) {
+			list = append(list, Anomaly{Kind: Malformed, RecordID: id, Key: key, Message: fmt.Sprintf("invalid digest %q", d)})
+		}
+	}
+	if len(rec.Digests) == 0 {
+		list = append(list, Anomaly{Kind: Malformed, RecordID: id, Key: key, Message: "record has no digests"})
+	}
+
+	prev := keys[key]
+	keys[key] = &keyState{id: id, digests: rec.Digests}
+	if prev == nil {
+		return list
+	}
+	switch {
+	case !isPrefix(prev.digests, rec.Digests):
+		list = append(list, Anomaly{
+			Kind:     Rewritten,
+			RecordID: id,
+			Key:      key,
+			Previous: prev.id,
+			Message:  fmt.Sprintf("digests %s do not extend %s", strings.Join(rec.Digests, " "), strings.Join(prev.digests, " ")),
+		})
+	case len(prev.digests) == len(rec.Digests):
+		list = append(list, Anomaly{
+			Kind:     Duplicate,
+			RecordID: id,
+			Key:      key,
+			Previous: prev.id,
+			Message:  "record adds no new digest",
+		})
+	}
+	return list
+}
+
+// isPrefix reports whether old is a prefix of new.
+func isPrefix(old, new []string) bool {
+	if len(old) > len(new) {
+		return false
+	}
+	for i := range old {
+		if old[i] != new[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashList is the stored hashes of the records audited so far.
+// It implements tlog.HashReader.
+type hashList struct {
+	records int64
+	hashes  []tlog.Hash
+}
+
+func (h *hashList) add(stored []tlog.Hash) {
+	h.records++
+	h.hashes = append(h.hashes, stored...)
+}
+
+func (h hashList) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	list := make([]tlog.Hash, len(indexes))
+	for i, x := range indexes {
+		if x < 0 || x >= int64(len(h.hashes)) {
+			return nil, fmt.Errorf("missing stored hash %d", x)
+		}
+		list[i] = h.hashes[x]
+	}
+	return list, nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/sumdb"
+	"go.transparencylog.com/tl/sumdb/sumdbtest"
+)
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return asset.Digest(sum[:])
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server looks up "path@n" and returns
+	// the record data for path stored in records.
+	records := make(map[string]string)
+	ts := sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		return []byte(records[path+"@"+vers]), nil
+	})
+	var n int
+	add := func(data string) {
+		key := fmt.Sprintf("r@%d", n)
+		n++
+		records[key] = data
+		if _, err := ts.Lookup(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Enough good records to span several tiles.
+	for i := 0; i < 600; i++ {
+		add(fmt.Sprintf("example.com/%d\n%s\n", i, digest(fmt.Sprint(i))))
+	}
+	add("example.com/1\n" + digest("1") + "\n" + digest("1 changed") + "\n") // appended: fine
+	add("example.com/2\n" + digest("2") + "\n")                              // duplicate
+	add("example.com/3\n" + digest("3 changed") + "\n")                      // rewritten
+	add("example.com/bad\nh1:notbase64!\n")                                  // malformed
+	add("example.com/nodigest\nmodified: 2020-01-01\n")                      // no digests
+
+	var progress []int64
+	a := &Auditor{
+		Remote:    sumdbtest.NewRemote(sumdb.NewServer(ts)),
+		Verifiers: []note.Verifier{verifier},
+		Batch:     2,
+		Progress:  func(done, total int64) { progress = append(progress, done) },
+	}
+	rep, err := a.Audit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.TreeSize != 605 || rep.Keys != 602 {
+		t.Fatalf("audited tree %d with %d keys, want 605 and 602", rep.TreeSize, rep.Keys)
+	}
+	if fmt.Sprint(progress) != "[512 605]" {
+		t.Fatalf("progress %v, want [512 605]", progress)
+	}
+	var got []string
+	for _, an := range rep.Anomalies {
+		got = append(got, fmt.Sprintf("%s %d %s %d", an.Kind, an.RecordID, an.Key, an.Previous))
+	}
+	want := []string{
+		"duplicate 601 example.com/2 2",
+		"rewritten 602 example.com/3 3",
+		"malformed 603 example.com/bad 0",
+		"malformed 604 example.com/nodigest 0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("anomalies:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// A log whose records do not hash to its signed tree is misbehaving.
+	a.Remote = sumdbtest.NewRemote(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := httptest.NewRecorder()
+		sumdb.NewServer(ts).ServeHTTP(rw, r)
+		w.WriteHeader(rw.Code)
+		w.Write([]byte(strings.Replace(rw.Body.String(), "example.com/300\n", "example.com/999\n", 1)))
+	}))
+	if _, err := a.Audit(ctx); !errors.Is(err, sumdb.ErrSecurity) {
+		t.Fatalf("Audit of tampered records: err = %v, want ErrSecurity", err)
+	}
+}
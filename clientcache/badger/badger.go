@@ -2,13 +2,17 @@ package badger
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	badger "github.com/dgraph-io/badger/v2"
 
@@ -21,6 +25,13 @@ type ClientCache struct {
 	cacheFile  string
 	serverURL  string
 	bdbOptions badger.Options
+
+	// bdb is opened on first use and shared by all operations
+	// until Close is called.
+	mu  sync.Mutex
+	bdb *badger.DB
+
+	evidenceDir string
 }
 
 func NewClientCache(cacheFile string, serverURL string) *ClientCache {
@@ -34,26 +45,12 @@ func NewClientCache(cacheFile string, serverURL string) *ClientCache {
 }
 
 func (c *ClientCache) ReadRemote(path string, query string) ([]byte, error) {
-	u, err := url.Parse(c.serverURL)
-	if err != nil {
-		log.Fatalf("ReadRemote: %v", err)
-	}
-	u.Path = path
-	u.RawQuery = query
+	return c.ReadRemoteContext(context.Background(), path, query)
+}
 
-	resp, err := http.Get(u.String())
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("http get: %v", resp.Status)
-	}
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
+// ReadRemoteContext is like ReadRemote but abandons the request when ctx is done.
+func (c *ClientCache) ReadRemoteContext(ctx context.Context, path string, query string) ([]byte, error) {
+	return sumdb.NewRemote(c.serverURL).ReadRemoteContext(ctx, path, query)
 }
 
 func (c *ClientCache) ReadConfig(file string) (data []byte, err error) {
@@ -89,16 +86,82 @@ func (c *ClientCache) Log(msg string) {
 	log.Print(msg)
 }
 
+// SecurityError prints the detailed report of server misbehavior.
+// The Client also returns an error wrapping sumdb.ErrSecurity,
+// which the caller uses to exit with the security exit code.
 func (c *ClientCache) SecurityError(msg string) {
-	log.Fatal(msg)
+	log.Print(msg)
 }
 
-func (c *ClientCache) bdRead(key string) ([]byte, error) {
+// SetEvidenceDir sets the directory in which SecurityEvidence
+// saves evidence of server misbehavior. If it is not set,
+// the evidence is only reported by SecurityError.
+func (c *ClientCache) SetEvidenceDir(dir string) {
+	c.evidenceDir = dir
+}
+
+// SecurityEvidence saves e as a JSON file in the evidence directory.
+// The file is named for the trees and the contents, so evidence
+// of the same fork detected again is saved only once.
+func (c *ClientCache) SecurityEvidence(e *sumdb.Evidence) {
+	if c.evidenceDir == "" {
+		return
+	}
+	js, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		log.Printf("saving evidence: %v", err)
+		return
+	}
+	js = append(js, '\n')
+	sum := sha256.Sum256(js)
+	file := filepath.Join(c.evidenceDir, fmt.Sprintf("fork-%d-%d-%x.json", e.OlderSize, e.NewerSize, sum[:4]))
+	if err := os.MkdirAll(c.evidenceDir, 0700); err != nil {
+		log.Printf("saving evidence: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(file, js, 0644); err != nil {
+		log.Printf("saving evidence: %v", err)
+		return
+	}
+	log.Printf("saved evidence of server misbehavior to %s", file)
+}
+
+// Close closes the underlying database, if it has been opened.
+func (c *ClientCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.bdb == nil {
+		return nil
+	}
+	err := c.bdb.Close()
+	c.bdb = nil
+	return err
+}
+
+// db returns the open database, opening it if necessary.
+// Badger holds an exclusive lock on the database directory,
+// so the handle is shared instead of reopened for each operation.
+func (c *ClientCache) db() (*badger.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.bdb != nil {
+		return c.bdb, nil
+	}
 	bdb, err := badger.Open(c.bdbOptions)
 	if err != nil {
 		return nil, err
 	}
-	defer bdb.Close()
+	c.bdb = bdb
+	return bdb, nil
+}
+
+func (c *ClientCache) bdRead(key string) ([]byte, error) {
+	bdb, err := c.db()
+	if err != nil {
+		return nil, err
+	}
 
 	var value []byte
 
@@ -126,11 +189,10 @@ func (c *ClientCache) bdRead(key string) ([]byte, error) {
 }
 
 func (c *ClientCache) bdWrite(key string, value []byte) error {
-	bdb, err := badger.Open(c.bdbOptions)
+	bdb, err := c.db()
 	if err != nil {
 		return err
 	}
-	defer bdb.Close()
 
 	err = bdb.Update(func(tx *badger.Txn) error {
 		return tx.Set([]byte(key), value)
@@ -140,11 +202,10 @@ func (c *ClientCache) bdWrite(key string, value []byte) error {
 }
 
 func (c *ClientCache) bdSwap(key string, old, value []byte) error {
-	bdb, err := badger.Open(c.bdbOptions)
+	bdb, err := c.db()
 	if err != nil {
 		return err
 	}
-	defer bdb.Close()
 
 	err = bdb.Update(func(tx *badger.Txn) error {
 		var txOld []byte
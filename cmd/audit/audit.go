@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/audit"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Replay every record in the log and check the log's tree hash",
+	Long: `Replay every record in the log and check the log's tree hash.
+
+tl audit downloads every record in the log, recomputes the log's tree hash
+from the records alone and checks that it matches the log's latest signed tree
+head. It also reports records that break the log's rules:
+
+  duplicate  a record for a URL that adds no digest to the previous record
+  rewritten  a record for a URL that does not keep the previous record's
+             digests, in order, before any new ones
+  malformed  a record with no key, no digests, or an invalid h1: line
+
+tl audit exits with status 6 if the records do not match the signed tree head
+and with status 1 if it finds any anomalies.`,
+
+	Args: cobra.NoArgs,
+
+	Run: run,
+}
+
+var (
+	batch   int
+	verbose bool
+)
+
+func init() {
+	AuditCmd.Flags().IntVar(&batch, "batch", 16, "number of record tiles, of 256 records each, to download at a time")
+	AuditCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print progress to stderr")
+}
+
+func run(cmd *cobra.Command, args []string) {
+	verifiers, err := config.LogVerifiers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	a := &audit.Auditor{
+		Remote:    sumdb.NewRemote(config.ServerURL),
+		Verifiers: verifiers,
+		Batch:     batch,
+	}
+	if verbose {
+		a.Progress = func(done, total int64) {
+			fmt.Fprintf(os.Stderr, "audited %d of %d records\n", done, total)
+		}
+	}
+
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	rep, err := a.Audit(ctx)
+	if rep == nil {
+		asset.Fatal(err)
+	}
+
+	if config.Output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		enc.Encode(rep)
+	} else {
+		for _, an := range rep.Anomalies {
+			fmt.Printf("%s\trecord %d\t%s\t%s\n", strings.ToUpper(an.Kind), an.RecordID, an.Key, an.Message)
+		}
+		fmt.Printf("audited tree %d %s: %d records, %d keys, %d anomalies\n", rep.TreeSize, rep.TreeHash, rep.TreeSize, rep.Keys, len(rep.Anomalies))
+	}
+
+	if err != nil {
+		asset.Fatal(err)
+	}
+	if len(rep.Anomalies) > 0 {
+		os.Exit(asset.ExitError)
+	}
+}
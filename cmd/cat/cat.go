@@ -1,71 +1,130 @@
 package cat
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
-	"encoding/base64"
-	"io/ioutil"
-	"log"
+	"fmt"
+	"io"
 	"net/http"
-	"net/url"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
 	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/spool"
 	"go.transparencylog.com/tl/sumdb"
 )
 
 var CatCmd = &cobra.Command{
 	Use:   "cat [URL]",
 	Short: "Cat the contents of a URL only if the contents can be verified with the asset transparency log",
+	Long: `Cat the contents of a URL only if the contents can be verified with the
+asset transparency log.
+
+The contents are held in memory, or spooled to a private temporary file if they
+are large, until they have been verified. Nothing is written to stdout before
+verification succeeds. With --output json the verification result is written
+to stderr, as stdout carries the contents.`,
 
 	Args: cobra.ExactArgs(1),
 
 	Run: cat,
 }
 
-func cat(cmd *cobra.Command, args []string) {
-	durl := args[0]
+// memThreshold is the amount of content kept in memory before
+// spooling to a temporary file.
+const memThreshold = 4 << 20
 
-	u, err := url.Parse(durl)
+var maxSize int64
+
+func init() {
+	CatCmd.Flags().Int64Var(&maxSize, "max-size", 0, "refuse URLs with contents larger than this many bytes (0 for no limit)")
+}
+
+func cat(cmd *cobra.Command, args []string) {
+	r, err := asset.NewResult(args[0])
+	if err == nil {
+		err = catURL(cmd.Context(), r, os.Stdout)
+	}
+	if config.Output == "json" {
+		r.SetError(err)
+		r.WriteJSON(os.Stderr)
+		if err != nil {
+			os.Exit(asset.ExitCode(err))
+		}
+		return
+	}
 	if err != nil {
-		panic(err)
+		asset.Fatal(err)
 	}
-	key := u.Host + u.Path
+}
+
+// catURL downloads r.URL, verifies it and only then writes it to w.
+// It does not exit the program, so the spooled content is always removed,
+// including when ctx is canceled by an interrupt.
+func catURL(ctx context.Context, r *asset.Result, w io.Writer) error {
+	ctx, cancel := config.Context(ctx)
+	defer cancel()
+
+	sp := spool.New(memThreshold, maxSize)
+	defer sp.Close()
 
 	cache := config.ClientCache()
-	client := sumdb.NewClient(cache)
+	defer cache.Close()
+	client := config.NewClient(cache)
 
-	// Step 1: Generate sha256sum of the file
-	resp, err := http.Get(durl)
-	if err != nil {
-		log.Fatal(err)
+	if err := Fetch(ctx, client, r, sp, maxSize); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
 
-	sum := sha256.Sum256(body)
+	// Step 3: cat it out
+	_, err := sp.WriteTo(w)
+	return err
+}
 
-	want := "h1:" + base64.StdEncoding.EncodeToString(sum[:])
+// Fetch downloads r.URL to w and verifies the downloaded content
+// with the asset transparency log using client. The content written
+// to w must not be used unless Fetch returns a nil error.
+// Both the download and the verification are canceled when ctx is done.
+// If maxSize is greater than zero, URLs reporting a larger content
+// length are refused without being downloaded, and a download that
+// turns out to be larger is abandoned once it exceeds maxSize.
+func Fetch(ctx context.Context, client *sumdb.Client, r *asset.Result, w io.Writer, maxSize int64) error {
+	durl := r.URL
 
-	// Step 2: Download the tlog entry for the URL
-	_, data, err := client.LookupOpts(key, sumdb.LookupOpts{Digest: want})
+	// Step 1: Generate sha256sum of the file while writing it out
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, durl, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	for _, line := range strings.Split(string(data), "\n") {
-		if line == want {
-			break
-		}
-		if strings.HasPrefix(line, "h1:") {
-			log.Fatalf("file digest %x != log digest %x", sum, line)
-		}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http get %s: %v", durl, resp.Status)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return fmt.Errorf("%s: content length %d exceeds --max-size %d", durl, resp.ContentLength, maxSize)
 	}
 
-	b := bytes.NewBuffer(body)
+	// The content length may be missing or wrong,
+	// so stop reading just past maxSize regardless.
+	body := io.Reader(resp.Body)
+	if maxSize > 0 {
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(h, w), body)
+	if err != nil {
+		return fmt.Errorf("%s: %v", durl, err)
+	}
+	if maxSize > 0 && n > maxSize {
+		return fmt.Errorf("%s: content exceeds --max-size %d", durl, maxSize)
+	}
+	sum := h.Sum(nil)
 
-	// Step 3: cat it out
-	b.WriteTo(os.Stdout)
+	// Step 2: Download the tlog entry for the URL and check it
+	return asset.Verify(ctx, client, r, sum, sumdb.LookupOpts{})
 }
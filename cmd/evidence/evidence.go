@@ -0,0 +1,93 @@
+package evidence
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var EvidenceCmd = &cobra.Command{
+	Use:   "evidence",
+	Short: "Check saved evidence of log server misbehavior",
+	Long: `Check saved evidence of log server misbehavior.
+
+When tl detects that the log server has signed two inconsistent tree heads, it
+saves the two signed tree heads and the proof that they are inconsistent as a
+JSON file in ~/.config/tl/evidence. The file can be handed to third parties,
+who can check it without access to the log server.`,
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check [file]...",
+	Short: "Verify that evidence files prove log server misbehavior",
+	Long: `Verify that evidence files prove log server misbehavior.
+
+Each file must hold two tree heads signed by the log key tl is configured with,
+or the key given with --log-key, and a valid proof that they are inconsistent.
+tl evidence check exits with status 1 if any file does not.`,
+
+	Args: cobra.MinimumNArgs(1),
+
+	Run: check,
+}
+
+var logKey string
+
+func init() {
+	checkCmd.Flags().StringVar(&logKey, "log-key", "", "verifier key of the log (default: the configured log key)")
+
+	EvidenceCmd.AddCommand(checkCmd)
+}
+
+func check(cmd *cobra.Command, args []string) {
+	var verifiers []note.Verifier
+	var err error
+	if logKey == "" {
+		verifiers, err = config.LogVerifiers()
+	} else {
+		var v note.Verifier
+		v, err = note.NewVerifier(strings.TrimSpace(logKey))
+		verifiers = append(verifiers, v)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log key: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range args {
+		e, err := read(file)
+		if err == nil {
+			err = e.Verify(note.VerifierList(verifiers...))
+		}
+		if err != nil {
+			fmt.Printf("FAIL\t%s\t%v\n", file, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("OK\t%s\t%s signed inconsistent trees %d and %d\n", file, verifiers[0].Name(), e.OlderSize, e.NewerSize)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// read reads the evidence in the named file.
+func read(file string) (*sumdb.Evidence, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	e := new(sumdb.Evidence)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("reading evidence: %v", err)
+	}
+	return e, nil
+}
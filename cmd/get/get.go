@@ -1,50 +1,166 @@
 package get
 
 import (
+	"bufio"
+	"context"
 	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
 	"io"
-	"log"
-	"net/url"
 	"os"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/cavaliercoder/grab"
 	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
 	"go.transparencylog.com/tl/config"
 	"go.transparencylog.com/tl/sumdb"
 )
 
 var GetCmd = &cobra.Command{
-	Use:   "get [URL]",
+	Use:   "get [URL]...",
 	Short: "Download a URL to a local file and verify the contents with the asset transparency log",
+	Long: `Download one or more URLs to local files and verify the contents with the
+asset transparency log.
 
-	Args: cobra.ExactArgs(1),
+Multiple URLs are downloaded in parallel. A download that fails verification is
+removed and the remaining downloads continue; a summary is printed at the end.`,
+
+	Args: getArgs,
 
 	Run: get,
 }
 
+var (
+	fromFile string
+	jobs     int
+)
+
+func init() {
+	GetCmd.Flags().StringVarP(&fromFile, "from-file", "f", "", "read URLs to download from this file, one per line (- for stdin)")
+	GetCmd.Flags().IntVarP(&jobs, "jobs", "j", 4, "number of downloads to run concurrently")
+}
+
+func getArgs(cmd *cobra.Command, args []string) error {
+	if fromFile != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
+// A download tracks the verification state of a single requested URL.
+type download struct {
+	result *asset.Result
+	req    *grab.Request // nil if no request could be made for the URL
+
+	sum       []byte
+	err       error // set if the URL was not downloaded and verified
+	verifyErr error // set if the downloaded file failed verification
+}
+
 func get(cmd *cobra.Command, args []string) {
-	durl := args[0]
+	urls := args
+	if fromFile != "" {
+		list, err := readURLs(fromFile)
+		if err != nil {
+			asset.Fatal(err)
+		}
+		urls = append(urls, list...)
+	}
 
-	u, err := url.Parse(durl)
+	cache := config.ClientCache()
+	defer cache.Close()
+
+	// All downloads share one client so that tiles and records
+	// fetched for one download are reused by the others.
+	client := config.NewClient(cache)
+
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	// A URL that cannot be requested, such as a malformed one,
+	// fails on its own without stopping the other downloads.
+	var downloads []*download
+	var reqs []*grab.Request
+	for _, durl := range urls {
+		req, err := newRequest(ctx, client, durl)
+		if err != nil {
+			r, _ := asset.NewResult(durl)
+			downloads = append(downloads, &download{result: r, err: err})
+			continue
+		}
+		downloads = append(downloads, req.Tag.(*download))
+		reqs = append(reqs, req)
+	}
+
+	if len(downloads) == 1 {
+		getOne(downloads[0])
+		return
+	}
+
+	// download and validate files
+	var resps []*grab.Response
+	if len(reqs) > 0 {
+		for resp := range grab.DefaultClient.DoBatch(jobs, reqs...) {
+			resps = append(resps, resp)
+		}
+	}
+	code := summarize(os.Stdout, downloads, resps)
+	cache.Close()
+	os.Exit(code)
+}
+
+// getOne downloads and validates a single download.
+func getOne(d *download) {
+	var resp *grab.Response
+	err := d.err
+	if err == nil {
+		resp = grab.DefaultClient.Do(d.req)
+		err = resp.Err()
+		cleanup(resp)
+	}
+	if config.Output == "json" {
+		d.result.SetError(err)
+		d.result.WriteJSON(os.Stdout)
+		if err != nil {
+			os.Exit(asset.ExitCode(err))
+		}
+		return
+	}
 	if err != nil {
-		panic(err)
+		fmt.Printf("Failed to grab: %v\n", err)
+		os.Exit(asset.ExitCode(err))
 	}
-	key := u.Host + u.Path
 
-	cache := config.ClientCache()
+	fmt.Printf("fetched note: %s/lookup/%s\n", config.ServerURL, d.result.Key)
+	if w := d.result.Warning(); w != "" {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	fmt.Printf("validated file sha256sum: %x\n", d.sum)
+	fmt.Println("Download validated and saved to", resp.Filename)
+}
+
+// newRequest returns a grab request for durl that verifies the
+// downloaded file with client before it is accepted.
+// Both the download and the verification are canceled when ctx is done.
+func newRequest(ctx context.Context, client *sumdb.Client, durl string) (*grab.Request, error) {
+	r, err := asset.NewResult(durl)
+	if err != nil {
+		return nil, err
+	}
 
 	// create download request
 	req, err := grab.NewRequest("", durl)
 	if err != nil {
-		fmt.Printf("failed to create grab request: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
+	req = req.WithContext(ctx)
 	req.NoCreateDirectories = true
 	req.SkipExisting = true
 
+	d := &download{result: r, req: req}
+	req.Tag = d
+
 	req.AfterCopy = func(resp *grab.Response) (err error) {
 		var f *os.File
 		f, err = os.Open(resp.Filename)
@@ -55,45 +171,99 @@ func get(cmd *cobra.Command, args []string) {
 			f.Close()
 		}()
 
-		h := sha256.New()
-		_, err = io.Copy(h, f)
+		fileSum, err := asset.Sum(f)
 		if err != nil {
 			return err
 		}
 
-		fileSum := h.Sum(nil)
-
 		// Download the tlog entry for the URL
-		want := "h1:" + base64.StdEncoding.EncodeToString(fileSum)
-		client := sumdb.NewClient(cache)
-		_, data, err := client.LookupOpts(key, sumdb.LookupOpts{Digest: want})
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Printf("fetched note: %s/lookup/%s\n", config.ServerURL, key)
-
-		for _, line := range strings.Split(string(data), "\n") {
-			if line == want {
-				break
-			}
-			if strings.HasPrefix(line, "h1:") {
-				log.Fatalf("file digest %x != log digest %x", fileSum, line)
-			}
+		if err := asset.Verify(ctx, client, r, fileSum, sumdb.LookupOpts{}); err != nil {
+			d.verifyErr = err
+			return err
 		}
 
-		fmt.Printf("validated file sha256sum: %x\n", fileSum)
-
+		d.sum = fileSum
 		req.SetChecksum(sha256.New(), fileSum, true)
 
 		return
 	}
 
-	// download and validate file
-	resp := grab.DefaultClient.Do(req)
-	if err := resp.Err(); err != nil {
-		fmt.Printf("Failed to grab: %v\n", err)
-		os.Exit(1)
+	return req, nil
+}
+
+// cleanup records the local file name of a completed response
+// and removes the downloaded file if it failed verification,
+// so that no unverified content is left behind.
+func cleanup(resp *grab.Response) {
+	d := resp.Request.Tag.(*download)
+	if d.verifyErr != nil && resp.Filename != "" {
+		os.Remove(resp.Filename)
+		return
 	}
+	d.result.File = resp.Filename
+}
 
-	fmt.Println("Download validated and saved to", resp.Filename)
+// summarize prints a table of the results of downloads, in order,
+// given the responses to their requests, and returns the exit code for
+// the most severe failure.
+func summarize(w io.Writer, downloads []*download, resps []*grab.Response) int {
+	for _, resp := range resps {
+		cleanup(resp)
+		resp.Request.Tag.(*download).err = resp.Err()
+	}
+
+	failed := 0
+	var errs []error
+	for _, d := range downloads {
+		if d.err != nil {
+			failed++
+			errs = append(errs, d.err)
+		}
+	}
+
+	if config.Output == "json" {
+		for _, d := range downloads {
+			d.result.SetError(d.err)
+			d.result.WriteJSON(w)
+		}
+		return asset.WorstExitCode(errs...)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, d := range downloads {
+		if d.err != nil {
+			fmt.Fprintf(tw, "FAIL\t%s\t\t%v\n", d.result.URL, d.err)
+			continue
+		}
+		fmt.Fprintf(tw, "OK\t%s\t%s\t%x\n", d.result.URL, d.result.File, d.sum)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "%d downloaded and validated, %d failed\n", len(downloads)-failed, failed)
+	return asset.WorstExitCode(errs...)
+}
+
+// readURLs reads a list of URLs from file, one per line.
+// Blank lines and lines starting with # are ignored.
+func readURLs(file string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var urls []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, s.Err()
 }
@@ -0,0 +1,194 @@
+package gossip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/config"
+)
+
+var GossipCmd = &cobra.Command{
+	Use:   "gossip",
+	Short: "Exchange signed tree heads with peers to detect split views of the log",
+	Long: `Exchange signed tree heads with peers to detect split views of the log.
+
+A log server could show different users different versions of the log. Users
+can detect this by exchanging the signed tree heads they have been shown: any
+two must be consistent with each other. For example, a team can keep a gossip
+file in a shared repository that each member appends to with
+
+  tl gossip export >> gossip.txt
+
+and checks with
+
+  tl gossip import gossip.txt`,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the latest signed tree head known to this client",
+
+	Args: cobra.NoArgs,
+
+	Run: export,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [FILE|URL]...",
+	Short: "Check that peers' signed tree heads are consistent with this client's",
+	Long: `Check that peers' signed tree heads are consistent with this client's.
+
+Each argument is a file or an http(s) URL holding one or more signed tree
+heads, one after another; - reads standard input. Each tree head is checked
+against the latest one known to this client, and newer ones become the latest.
+A tree head that is inconsistent with this client's view of the log is proof
+that the log server is misbehaving: the proof is printed and tl gossip import
+exits with the security error status.`,
+
+	Args: cobra.MinimumNArgs(1),
+
+	Run: gossipImport,
+}
+
+func init() {
+	GossipCmd.AddCommand(exportCmd)
+	GossipCmd.AddCommand(importCmd)
+}
+
+func export(cmd *cobra.Command, args []string) {
+	cache := config.ClientCache()
+	defer cache.Close()
+	client := config.NewClient(cache)
+
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	tree, msg, err := client.LoadLatest(ctx)
+	if err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+	if tree.N == 0 {
+		cache.Close()
+		asset.Fatal(errors.New("no signed tree head yet: look up a URL first"))
+	}
+	os.Stdout.Write(msg)
+}
+
+func gossipImport(cmd *cobra.Command, args []string) {
+	cache := config.ClientCache()
+	defer cache.Close()
+	client := config.NewClient(cache)
+
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	var errs []error
+	for _, arg := range args {
+		data, err := read(ctx, arg)
+		if err != nil {
+			fmt.Printf("FAIL\t%s\t%v\n", arg, err)
+			errs = append(errs, err)
+			continue
+		}
+		for _, msg := range splitNotes(data) {
+			err := client.MergeLatest(ctx, msg)
+			if err != nil {
+				fmt.Printf("FAIL\t%s\t%s\t%v\n", arg, describe(msg), err)
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Printf("OK\t%s\t%s\n", arg, describe(msg))
+		}
+	}
+
+	tree, _ := client.Latest()
+	fmt.Printf("latest tree: %d %s\n", tree.N, tree.Hash)
+	cache.Close()
+	os.Exit(asset.WorstExitCode(errs...))
+}
+
+// read returns the contents of the named file or http(s) URL.
+func read(ctx context.Context, name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		return ioutil.ReadFile(name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http get %s: %v", name, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// splitNotes splits data into the signed notes it holds, one after another.
+// A signed note is its text, a blank line, and one or more signature lines
+// beginning with an em dash, so a note ends at the first line after its
+// signatures that is not itself a signature. Blank lines between notes
+// are ignored.
+func splitNotes(data []byte) [][]byte {
+	var notes [][]byte
+	var cur bytes.Buffer
+	inSigs := false // cur has reached its signature lines
+	s := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := s.ReadString('\n')
+		if line != "" {
+			isSig := strings.HasPrefix(line, "— ")
+			switch {
+			case inSigs && !isSig:
+				notes = append(notes, append([]byte(nil), cur.Bytes()...))
+				cur.Reset()
+				inSigs = false
+			case cur.Len() > 0 && strings.HasSuffix(cur.String(), "\n\n") && isSig:
+				inSigs = true
+			}
+			if cur.Len() > 0 || strings.TrimSpace(line) != "" {
+				cur.WriteString(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if cur.Len() > 0 {
+		notes = append(notes, cur.Bytes())
+	}
+	return notes
+}
+
+// describe returns a short description of the tree in the signed note msg
+// for messages. The note is not verified.
+func describe(msg []byte) string {
+	i := bytes.Index(msg, []byte("\n\n"))
+	if i < 0 {
+		return "malformed note"
+	}
+	tree, err := tlog.ParseTree(msg[:i+1])
+	if err != nil {
+		return "malformed note"
+	}
+	return fmt.Sprintf("tree %d %s", tree.N, tree.Hash)
+}
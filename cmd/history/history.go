@@ -0,0 +1,163 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history [URL]",
+	Short: "List every digest the asset transparency log has recorded for a URL",
+	Long: `List every digest the asset transparency log has recorded for a URL, oldest
+first, along with any metadata the log record carries.
+
+With --file, also report whether the local file matches the newest recorded
+digest, an older one, or none of them. Matching no recorded digest is a
+verification failure; matching an older digest is reported but is not.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: history,
+}
+
+var file string
+
+func init() {
+	HistoryCmd.Flags().StringVarP(&file, "file", "f", "", "compare the digest of this local file with the recorded digests")
+}
+
+// Values of the match field reported for --file.
+const (
+	matchNewest = "newest"
+	matchOlder  = "older"
+	matchNone   = "none"
+)
+
+// A report is the JSON output of tl history.
+type report struct {
+	*asset.Result
+	*asset.Record
+	Match string `json:"match,omitempty"`
+}
+
+func history(cmd *cobra.Command, args []string) {
+	rep := &report{Record: new(asset.Record)}
+	r, err := asset.NewResult(args[0])
+	rep.Result = r
+	r.File = file
+	if err == nil {
+		err = lookup(cmd.Context(), rep)
+	}
+	if err != nil {
+		fail(rep, err)
+	}
+
+	var matchErr error
+	if file != "" {
+		i := rep.Index(r.Digest)
+		switch {
+		case i < 0:
+			rep.Match = matchNone
+			matchErr = fmt.Errorf("%w: file digest %s is not in the log record", asset.ErrMismatch, r.Digest)
+		case i == len(rep.Digests)-1:
+			rep.Match = matchNewest
+		default:
+			rep.Match = matchOlder
+		}
+	}
+
+	if config.Output == "json" {
+		rep.Result.SetError(matchErr)
+		json.NewEncoder(os.Stdout).Encode(rep)
+		os.Exit(asset.ExitCode(matchErr))
+	}
+
+	fmt.Printf("fetched note: %s/lookup/%s\n", config.ServerURL, r.Key)
+	fmt.Printf("record %d in tree of size %d\n", r.RecordID, r.TreeSize)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, d := range rep.Digests {
+		var notes []string
+		if i == len(rep.Digests)-1 {
+			notes = append(notes, "newest")
+		}
+		if file != "" && d == r.Digest {
+			notes = append(notes, "matches "+file)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", i+1, d, strings.Join(notes, ", "))
+	}
+	tw.Flush()
+
+	if len(rep.Metadata) > 0 {
+		fmt.Println("metadata:")
+		for _, line := range rep.Metadata {
+			fmt.Printf("\t%s\n", line)
+		}
+	}
+
+	switch rep.Match {
+	case matchNewest:
+		fmt.Printf("%s matches the newest recorded digest\n", file)
+	case matchOlder:
+		fmt.Printf("%s matches an older recorded digest (%d of %d)\n", file, rep.Index(r.Digest)+1, len(rep.Digests))
+	case matchNone:
+		asset.Fatal(matchErr)
+	}
+}
+
+// lookup fetches and authenticates the log record for rep.Key
+// and computes the digest of the local file, if any.
+func lookup(ctx context.Context, rep *report) error {
+	r := rep.Result
+	if r.File != "" {
+		f, err := os.Open(r.File)
+		if err != nil {
+			return err
+		}
+		sum, err := asset.Sum(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		r.Digest = asset.Digest(sum)
+	}
+
+	cache := config.ClientCache()
+	defer cache.Close()
+	client := config.NewClient(cache)
+
+	ctx, cancel := config.Context(ctx)
+	defer cancel()
+
+	id, data, err := client.LookupContext(ctx, r.Key, sumdb.LookupOpts{})
+	if err != nil {
+		return err
+	}
+	r.RecordID = id
+	tree, msg := client.Latest()
+	r.TreeSize = tree.N
+	r.TreeHash = tree.Hash.String()
+	r.SignedNote = string(msg)
+
+	rep.Record = asset.ParseRecord(data)
+	return nil
+}
+
+// fail reports the failed lookup and exits.
+func fail(rep *report, err error) {
+	if config.Output == "json" {
+		rep.Result.SetError(err)
+		json.NewEncoder(os.Stdout).Encode(rep)
+		os.Exit(asset.ExitCode(err))
+	}
+	asset.Fatal(err)
+}
@@ -0,0 +1,170 @@
+package key
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var KeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the trusted keys of the log",
+	Long: `Manage the trusted keys of the log.
+
+tl accepts tree heads signed by any trusted key of the log that is valid at the
+time they are fetched. The trusted keys are read from ~/.config/tl/trust, which
+holds one verifier key per line, optionally followed by not-before=TIME and
+not-after=TIME in RFC 3339 format. Without that file tl trusts its built-in
+log key at all times.
+
+To rotate the log key, the log operator signs a rotation statement for the new
+key with the current key using tl key rotate, and users add the new key to
+their trust configuration with tl key trust.`,
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the trusted keys of the log",
+
+	Args: cobra.NoArgs,
+
+	Run: list,
+}
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate [new verifier key]",
+	Short: "Sign a rotation statement introducing a new log key",
+	Long: `Sign a rotation statement introducing a new log key.
+
+The statement is signed with the log's current private key, read from the file
+given with --signer-key, and printed to standard output. The new key must have
+the same name as the current one.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: rotate,
+}
+
+var trustCmd = &cobra.Command{
+	Use:   "trust [statement file]",
+	Short: "Trust the new log key introduced by a rotation statement",
+	Long: `Trust the new log key introduced by a rotation statement.
+
+The statement must be signed by a trusted key of the log that is valid now.
+The new key is added to ~/.config/tl/trust, along with the keys trusted so far.
+It cannot be used while TL_DEBUG_SERVERKEY overrides the trust file.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: trust,
+}
+
+var (
+	signerKey string
+	notBefore string
+	notAfter  string
+)
+
+func init() {
+	rotateCmd.Flags().StringVar(&signerKey, "signer-key", "", "file holding the log's current private signing key")
+	rotateCmd.Flags().StringVar(&notBefore, "not-before", "", "time, in RFC 3339 format, from which the new key may sign tree heads")
+	rotateCmd.Flags().StringVar(&notAfter, "not-after", "", "time, in RFC 3339 format, until which the new key may sign tree heads")
+	rotateCmd.MarkFlagRequired("signer-key")
+
+	KeyCmd.AddCommand(listCmd)
+	KeyCmd.AddCommand(rotateCmd)
+	KeyCmd.AddCommand(trustCmd)
+}
+
+func trusted() []sumdb.TrustedKey {
+	data, err := config.Trust()
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys, err := sumdb.ParseTrust(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return keys
+}
+
+func list(cmd *cobra.Command, args []string) {
+	now := time.Now()
+	for _, k := range trusted() {
+		state := "valid"
+		if !k.ValidAt(now) {
+			state = "invalid"
+		}
+		fmt.Printf("%s\t%s\n", state, k)
+	}
+}
+
+func rotate(cmd *cobra.Command, args []string) {
+	signer, err := config.ReadSigner(signerKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	k := sumdb.TrustedKey{Key: args[0]}
+	if notBefore != "" {
+		if k.NotBefore, err = time.Parse(time.RFC3339, notBefore); err != nil {
+			log.Fatalf("invalid --not-before: %v", err)
+		}
+	}
+	if notAfter != "" {
+		if k.NotAfter, err = time.Parse(time.RFC3339, notAfter); err != nil {
+			log.Fatalf("invalid --not-after: %v", err)
+		}
+	}
+
+	msg, err := sumdb.SignRotation(signer, k)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(msg)
+}
+
+func trust(cmd *cobra.Command, args []string) {
+	// The trust file is not used with TL_DEBUG_SERVERKEY,
+	// and must not be rebuilt from the debug key.
+	if os.Getenv("TL_DEBUG_SERVERKEY") != "" {
+		log.Fatalf("cannot update %s while TL_DEBUG_SERVERKEY is set", config.TrustFile())
+	}
+	msg, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys := trusted()
+	k, err := sumdb.OpenRotation(msg, keys, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, old := range keys {
+		if old.Key == k.Key {
+			log.Fatalf("key %s is already trusted", k.Key)
+		}
+	}
+
+	// Append to the trust file, keeping any comments,
+	// or create it holding the keys trusted so far.
+	data, err := ioutil.ReadFile(config.TrustFile())
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	if err != nil {
+		data = sumdb.FormatTrust(keys)
+	} else if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, sumdb.FormatTrust([]sumdb.TrustedKey{k})...)
+	if err := ioutil.WriteFile(config.TrustFile(), data, 0600); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("trusted %s\n", k)
+}
@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/mirror"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var MirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Keep a verified local copy of the whole log and serve it",
+	Long: `Keep a verified local copy of the whole log and serve it.
+
+"tl mirror sync DIR" downloads every tile of the log into DIR, authenticating
+them against the log's signed tree head, and resumes from where it left off
+each time it is run. "tl mirror serve DIR" serves the copy with the same HTTP
+protocol as the log server, so clients can use it in place of the log by
+setting TL_DEBUG_SERVERURL. Clients still check everything the mirror serves
+against the log's key.`,
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [dir]",
+	Short: "Download the log's tiles published since the last sync",
+
+	Args: cobra.ExactArgs(1),
+
+	Run: syncMirror,
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [dir]",
+	Short: "Serve a mirrored log over HTTP",
+
+	Args: cobra.ExactArgs(1),
+
+	Run: serve,
+}
+
+var (
+	listen   string
+	interval time.Duration
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&listen, "listen", "localhost:8082", "address to listen on")
+	serveCmd.Flags().DurationVar(&interval, "sync-interval", 0, "also sync the mirror this often (0 disables)")
+
+	MirrorCmd.AddCommand(syncCmd)
+	MirrorCmd.AddCommand(serveCmd)
+}
+
+func newMirror(dir string) *mirror.Mirror {
+	verifiers, err := config.LogVerifiers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mirror.New(dir, verifiers...)
+}
+
+func syncMirror(cmd *cobra.Command, args []string) {
+	m := newMirror(args[0])
+
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	old, tree, err := m.Sync(ctx, sumdb.NewRemote(config.ServerURL))
+	if err != nil {
+		asset.Fatal(err)
+	}
+	fmt.Printf("synced tree %d to tree %d %s\n", old.N, tree.N, tree.Hash)
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	m := newMirror(args[0])
+	if tree, _, err := m.Latest(); err != nil {
+		log.Fatal(err)
+	} else if tree.N == 0 {
+		log.Printf("warning: %s has not been synced yet", args[0])
+	}
+
+	if interval > 0 {
+		go func() {
+			r := sumdb.NewRemote(config.ServerURL)
+			for {
+				old, tree, err := m.Sync(cmd.Context(), r)
+				switch {
+				case err != nil:
+					log.Printf("sync: %v", err)
+				case tree.N > old.N:
+					log.Printf("synced tree %d to tree %d", old.N, tree.N)
+				}
+				time.Sleep(interval)
+			}
+		}()
+	}
+
+	srv := sumdb.NewServer(m)
+	mux := http.NewServeMux()
+	for _, path := range sumdb.ServerPaths {
+		mux.Handle(path, srv)
+	}
+
+	log.Printf("serving mirror of %s from %s on http://%s", config.ServerURL, args[0], listen)
+	log.Fatal(http.ListenAndServe(listen, mux))
+}
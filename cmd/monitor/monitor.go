@@ -0,0 +1,103 @@
+package monitor
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/clientcache/badger"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/monitor"
+)
+
+var MonitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Watch the log's tree heads and alert on stalls, rollbacks and forks",
+	Long: `Watch the log's tree heads and alert on stalls, rollbacks and forks.
+
+tl monitor polls the log for its latest signed tree head and checks that it is
+consistent with every tree head checked before. It alerts when the log does not
+grow for longer than --stall, when it serves a tree older than one it served
+before, and when it serves a tree inconsistent with its history, which is proof
+that the log is misbehaving.
+
+Alerts are printed to standard output and, with --exec, passed to a command as
+a JSON object on its standard input or, with --webhook, posted as a JSON object
+to a local HTTP endpoint. Every distinct tree head seen is appended to the
+--history file, which can be checked again with "tl gossip import".`,
+
+	Args: cobra.NoArgs,
+
+	Run: run,
+}
+
+var (
+	interval    time.Duration
+	stall       time.Duration
+	dbFile      string
+	historyFile string
+	execCmd     string
+	webhook     string
+)
+
+func init() {
+	MonitorCmd.Flags().DurationVar(&interval, "interval", time.Minute, "how often to poll the log for a new tree head")
+	MonitorCmd.Flags().DurationVar(&stall, "stall", time.Hour, "alert if the log does not grow for this long (0 disables)")
+	MonitorCmd.Flags().StringVar(&dbFile, "db", "", "database holding the monitor's checked tree head (default ~/.config/tl/monitor.badger.db)")
+	MonitorCmd.Flags().StringVar(&historyFile, "history", "", "file to append every tree head seen to (default ~/.config/tl/monitor.heads)")
+	MonitorCmd.Flags().StringVar(&execCmd, "exec", "", "command to run for each alert, such as \"notify-admin --urgent\"")
+	MonitorCmd.Flags().StringVar(&webhook, "webhook", "", "URL to post each alert to, such as http://localhost:9000/alerts")
+}
+
+// cache is a ClientCache that passes security error reports
+// to the monitor instead of logging them, so they reach the alert sinks.
+type cache struct {
+	*badger.ClientCache
+	m *monitor.Monitor
+}
+
+func (c cache) SecurityError(msg string) {
+	c.m.Report(msg)
+}
+
+func run(cmd *cobra.Command, args []string) {
+	dir := config.Dir()
+	if dbFile == "" {
+		dbFile = filepath.Join(dir, "monitor.badger.db")
+	}
+	if historyFile == "" {
+		historyFile = filepath.Join(dir, "monitor.heads")
+	}
+
+	sinks := monitor.Sinks{&monitor.WriterSink{W: os.Stdout, JSON: config.Output == "json"}}
+	if execCmd != "" {
+		f := strings.Fields(execCmd)
+		sinks = append(sinks, &monitor.ExecSink{Path: f[0], Args: f[1:]})
+	}
+	if webhook != "" {
+		sinks = append(sinks, &monitor.WebhookSink{URL: webhook})
+	}
+
+	history, err := os.OpenFile(historyFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer history.Close()
+
+	m := &monitor.Monitor{
+		Sink:       sinks,
+		History:    history,
+		StallAfter: stall,
+	}
+	c := cache{config.OpenClientCache(dbFile), m}
+	defer c.Close()
+	m.Client = config.NewClient(c)
+
+	// Run returns when the first interrupt cancels the command's context,
+	// so the checked tree head is saved as the database is closed.
+	log.Printf("monitoring %s every %v", config.ServerURL, interval)
+	m.Run(cmd.Context(), interval)
+}
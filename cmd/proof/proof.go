@@ -0,0 +1,216 @@
+package proof
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/config"
+	tlproof "go.transparencylog.com/tl/proof"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var ProofCmd = &cobra.Command{
+	Use:   "proof",
+	Short: "Export and verify self-contained proofs that the log vouches for an asset",
+	Long: `Export and verify self-contained proofs that the log vouches for an asset.
+
+A proof bundle holds the log record for a URL, a signed tree head of the log,
+a proof that the record is contained in that tree, and the log's public key.
+Bundles can be attached to release artifacts so that downstream auditors can
+check them without network access or a tl cache.`,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [URL]",
+	Short: "Write a proof bundle for the asset at a URL",
+	Long: `Write a proof bundle showing that the log vouches for the asset at a URL.
+
+The asset is identified by its digest, given with --digest or computed from a
+local copy with --file.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: export,
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [bundle] [file]",
+	Short: "Verify a file against a proof bundle without network access",
+	Long: `Verify a file against a proof bundle without network access.
+
+The bundle must be signed by one of the log keys tl trusts, valid when the
+bundle was exported, or by the key given with --log-key; the key recorded in
+the bundle is not trusted.`,
+
+	Args: cobra.ExactArgs(2),
+
+	Run: verify,
+}
+
+var (
+	digest  string
+	file    string
+	outFile string
+	logKey  string
+)
+
+func init() {
+	exportCmd.Flags().StringVar(&digest, "digest", "", "digest of the asset, such as h1:...")
+	exportCmd.Flags().StringVarP(&file, "file", "f", "", "compute the digest of the asset from this local file")
+	exportCmd.Flags().StringVarP(&outFile, "out", "o", "", "write the bundle to this file instead of stdout")
+
+	verifyCmd.Flags().StringVar(&logKey, "log-key", "", "verifier key of the log (default: the trusted log keys)")
+
+	ProofCmd.AddCommand(exportCmd)
+	ProofCmd.AddCommand(verifyCmd)
+}
+
+func export(cmd *cobra.Command, args []string) {
+	r, err := asset.NewResult(args[0])
+	if err != nil {
+		asset.Fatal(err)
+	}
+	switch {
+	case file != "" && digest != "":
+		asset.Fatal(fmt.Errorf("%w: --digest and --file are mutually exclusive", asset.ErrUsage))
+	case file != "":
+		sum, err := sumFile(file)
+		if err != nil {
+			asset.Fatal(err)
+		}
+		digest = asset.Digest(sum)
+	case digest == "":
+		asset.Fatal(fmt.Errorf("%w: one of --digest or --file is required", asset.ErrUsage))
+	}
+
+	cache := config.ClientCache()
+	defer cache.Close()
+	client := config.NewClient(cache)
+
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	id, data, err := client.LookupContext(ctx, r.Key, sumdb.LookupOpts{Digest: digest})
+	if err == nil {
+		err = asset.Check(data, digest)
+	}
+	if err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+
+	tree, msg, err := client.LoadLatest(ctx)
+	if err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+	p, err := client.ProveRecord(ctx, id, tree)
+	if err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+	trusted, err := trustedKeys()
+	if err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+	_, k, err := sumdb.SigningKey(msg, trusted)
+	if err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+
+	b := &tlproof.Bundle{
+		URL:        r.URL,
+		Key:        r.Key,
+		Digest:     digest,
+		RecordID:   id,
+		Record:     string(data),
+		SignedNote: string(msg),
+		Proof:      p,
+		LogKey:     k.Key,
+		Time:       time.Now().UTC(),
+	}
+
+	var w io.Writer = os.Stdout
+	if outFile != "" {
+		f, err := os.Create(outFile)
+		if err != nil {
+			cache.Close()
+			asset.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := b.Write(w); err != nil {
+		cache.Close()
+		asset.Fatal(err)
+	}
+}
+
+func verify(cmd *cobra.Command, args []string) {
+	f, err := os.Open(args[0])
+	if err != nil {
+		asset.Fatal(err)
+	}
+	b, err := tlproof.Read(f)
+	f.Close()
+	if err != nil {
+		asset.Fatal(err)
+	}
+
+	r := &asset.Result{URL: b.URL, Key: b.Key, File: args[1], RecordID: b.RecordID, SignedNote: b.SignedNote}
+	if tree, err := b.Tree(); err == nil {
+		r.TreeSize = tree.N
+		r.TreeHash = tree.Hash.String()
+	}
+
+	sum, err := sumFile(args[1])
+	if err == nil {
+		r.Digest = asset.Digest(sum)
+		var trusted []sumdb.TrustedKey
+		if logKey != "" {
+			trusted = []sumdb.TrustedKey{{Key: logKey}}
+		} else {
+			trusted, err = trustedKeys()
+		}
+		if err == nil {
+			err = b.Verify(trusted, r.Digest, time.Now())
+		}
+	}
+
+	if config.Output == "json" {
+		r.SetError(err)
+		r.WriteJSON(os.Stdout)
+		os.Exit(asset.ExitCode(err))
+	}
+	if err != nil {
+		asset.Fatal(err)
+	}
+	fmt.Printf("verified record %d for %s in tree %d\n", b.RecordID, b.Key, r.TreeSize)
+	fmt.Printf("validated file sha256sum: %x\n", sum)
+}
+
+// trustedKeys returns the configured trusted log keys.
+func trustedKeys() ([]sumdb.TrustedKey, error) {
+	trust, err := config.Trust()
+	if err != nil {
+		return nil, err
+	}
+	return sumdb.ParseTrust(trust)
+}
+
+// sumFile returns the sha256 sum of the named file.
+func sumFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return asset.Sum(f)
+}
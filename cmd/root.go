@@ -15,15 +15,32 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/cmd/audit"
 	"go.transparencylog.com/tl/cmd/cat"
+	"go.transparencylog.com/tl/cmd/evidence"
 	"go.transparencylog.com/tl/cmd/get"
+	"go.transparencylog.com/tl/cmd/gossip"
+	"go.transparencylog.com/tl/cmd/history"
+	"go.transparencylog.com/tl/cmd/key"
+	"go.transparencylog.com/tl/cmd/mirror"
+	"go.transparencylog.com/tl/cmd/monitor"
+	"go.transparencylog.com/tl/cmd/proof"
+	"go.transparencylog.com/tl/cmd/run"
+	"go.transparencylog.com/tl/cmd/serve"
+	"go.transparencylog.com/tl/cmd/servemirror"
 	"go.transparencylog.com/tl/cmd/update"
 	"go.transparencylog.com/tl/cmd/verify"
 	"go.transparencylog.com/tl/cmd/version"
+	"go.transparencylog.com/tl/cmd/witness"
+	"go.transparencylog.com/tl/config"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -35,19 +52,68 @@ https:// URLs with a cryptographic integrity validation. The public
 transparency log tl uses provides users an assurance that the cryptographic
 hash digest of the asset you are downloading does not differ from the value in
 a public immutable log.`,
+
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch config.Output {
+		case "text", "json":
+		default:
+			return fmt.Errorf("invalid --output %q: must be text or json", config.Output)
+		}
+		return config.CheckWitnesses()
+	},
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&config.Output, "output", "text", "output format: text or json")
+	rootCmd.PersistentFlags().StringArrayVar(&config.Witnesses, "witness", config.Witnesses, "require tree heads to be cosigned by the witness with this verifier key (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&config.WitnessURLs, "witness-url", config.WitnessURLs, "read cosigned tree heads from the witness server at this URL (repeatable)")
+	rootCmd.PersistentFlags().IntVar(&config.WitnessThreshold, "witness-threshold", config.WitnessThreshold, "number of --witness cosignatures required (-1 for all)")
+	rootCmd.PersistentFlags().BoolVar(&config.Proofs, "proofs", config.Proofs, "check records and tree heads with the log's proof endpoints instead of tiles")
+	rootCmd.PersistentFlags().DurationVar(&config.Timeout, "timeout", 0, "give up on network operations after this long, such as 30s (0 for no limit)")
+
 	rootCmd.AddCommand(get.GetCmd)
 	rootCmd.AddCommand(verify.VerifyCmd)
 	rootCmd.AddCommand(cat.CatCmd)
+	rootCmd.AddCommand(history.HistoryCmd)
+	rootCmd.AddCommand(run.RunCmd)
+	rootCmd.AddCommand(serve.ServeCmd)
+	rootCmd.AddCommand(servemirror.ServeMirrorCmd)
+	rootCmd.AddCommand(mirror.MirrorCmd)
+	rootCmd.AddCommand(witness.WitnessCmd)
+	rootCmd.AddCommand(gossip.GossipCmd)
+	rootCmd.AddCommand(monitor.MonitorCmd)
+	rootCmd.AddCommand(evidence.EvidenceCmd)
+	rootCmd.AddCommand(audit.AuditCmd)
+	rootCmd.AddCommand(key.KeyCmd)
+	rootCmd.AddCommand(proof.ProofCmd)
 	rootCmd.AddCommand(version.Cmd)
 	rootCmd.AddCommand(update.Cmd)
 }
 
+// Execute runs the tl command line.
+// Errors returned to cobra are command line usage errors;
+// the commands themselves exit with the codes documented in package asset.
+//
+// An interrupt or SIGTERM cancels the context of the running command so
+// that it can stop its network operations, clean up and report the
+// failure. This is the only signal handler: commands watch their context
+// instead. A second signal exits at once, for a command that is slow to
+// stop, such as a server waiting for its requests to finish.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		cancel()
+		<-sigc
 		os.Exit(1)
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		fmt.Println(err)
+		os.Exit(asset.ExitUsage)
 	}
 }
@@ -0,0 +1,163 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/cmd/cat"
+	"go.transparencylog.com/tl/config"
+)
+
+var RunCmd = &cobra.Command{
+	Use:     "run [URL] [-- args...]",
+	Aliases: []string{"sh"},
+	Short:   "Run a script from a URL only if its contents can be verified with the asset transparency log",
+	Long: `Run a script from a URL only if its contents can be verified with the asset
+transparency log.
+
+The script is downloaded to a private temporary file and verified exactly like
+cat. Only then is it marked executable and run with the remaining arguments,
+either directly or with --interpreter. When invoked as "tl sh" the default
+interpreter is sh. tl exits with the exit status of the script; if the script
+is killed by a signal, tl exits with 128 plus the signal number.
+
+Everything after the URL is passed to the script, so flags for tl must come
+before it:
+
+  tl run --interpreter bash https://example.com/install.sh -- --prefix /opt`,
+
+	Args: cobra.MinimumNArgs(1),
+
+	Run: run,
+}
+
+var (
+	interpreter string
+	maxSize     int64
+)
+
+func init() {
+	RunCmd.Flags().StringVar(&interpreter, "interpreter", "", "run the script with this command, such as bash (default: execute the script directly)")
+	RunCmd.Flags().Int64Var(&maxSize, "max-size", 0, "refuse URLs with contents larger than this many bytes (0 for no limit)")
+
+	// Leave flags after the URL for the script.
+	RunCmd.Flags().SetInterspersed(false)
+}
+
+func run(cmd *cobra.Command, args []string) {
+	if interpreter == "" && cmd.CalledAs() == "sh" {
+		interpreter = "sh"
+	}
+	scriptArgs := args[1:]
+	if len(scriptArgs) > 0 && scriptArgs[0] == "--" {
+		scriptArgs = scriptArgs[1:]
+	}
+
+	r, err := asset.NewResult(args[0])
+	if err != nil {
+		fail(r, err)
+	}
+
+	script, err := fetch(cmd.Context(), r)
+	if err != nil {
+		fail(r, err)
+	}
+	if config.Output == "json" {
+		r.WriteJSON(os.Stderr)
+	}
+
+	code, err := execScript(cmd.Context(), script, scriptArgs)
+	os.Remove(script)
+	if err != nil {
+		asset.Fatal(err)
+	}
+	os.Exit(code)
+}
+
+// fetch downloads and verifies r.URL into a private executable file
+// and returns its name. Nothing is left behind if verification fails
+// or ctx is canceled by an interrupt.
+func fetch(ctx context.Context, r *asset.Result) (_ string, err error) {
+	f, err := ioutil.TempFile("", "tl-run-")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(name)
+		}
+	}()
+
+	cache := config.ClientCache()
+	defer cache.Close()
+
+	ctx, cancel := config.Context(ctx)
+	defer cancel()
+
+	err = cat.Fetch(ctx, config.NewClient(cache), r, f, maxSize)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(name, 0700); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// execScript runs script with args and returns its exit status.
+// When ctx is done, it sends the script SIGTERM and waits for it to exit.
+func execScript(ctx context.Context, script string, args []string) (int, error) {
+	argv := append([]string{script}, args...)
+	if interpreter != "" {
+		argv = append(strings.Fields(interpreter), argv...)
+	}
+
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Process.Signal(syscall.SIGTERM)
+		case <-done:
+		}
+	}()
+
+	err := c.Wait()
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return ee.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// fail reports that r could not be verified and exits without running it.
+func fail(r *asset.Result, err error) {
+	if config.Output == "json" {
+		r.SetError(err)
+		r.WriteJSON(os.Stderr)
+		os.Exit(asset.ExitCode(err))
+	}
+	asset.Fatal(err)
+}
@@ -0,0 +1,142 @@
+package serve
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/ingest"
+	"go.transparencylog.com/tl/logstore/badger"
+	"go.transparencylog.com/tl/sequencer"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an asset transparency log server",
+	Long: `Run an asset transparency log server.
+
+tl serve keeps the log's records, stored hashes and signed tree head in a
+badger database (--db) and serves them over HTTP with the same protocol as the
+public log, so tl can be pointed at it with TL_DEBUG_SERVERURL and
+TL_DEBUG_SERVERKEY.
+
+A lookup of a URL the log has no record for fetches the URL over https,
+records the digest of its contents and returns the new record. The server only
+fetches from public addresses, unless --allow-private is set, and only from the
+hosts allowed by --allow-host and --deny-host. Lookups refused by these rules
+get a 403 response, and lookups beyond the fetch rate limits a 429 response.
+
+New records are added to the log in batches, every --batch-interval or as soon
+as --batch-size records are waiting, and the log signs one tree head per batch.
+Lookups of records still waiting get a 503 response with a Retry-After header,
+which tl waits for before looking again.
+
+Use "tl serve genkey" to create the log's signing key, and give the printed
+verifier key to the users of the log.`,
+
+	Args: cobra.NoArgs,
+
+	Run: serve,
+}
+
+var genkeyCmd = &cobra.Command{
+	Use:   "genkey [name]",
+	Short: "Generate a log signing key",
+	Long: `Generate a log signing key with the given name, such as
+log.example.com. The private key is written to --key-file, which must not
+exist, and the verifier key is printed.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: genkey,
+}
+
+var (
+	keyFile string
+	listen  string
+	dbFile  string
+	policy  ingest.Policy
+
+	batchInterval time.Duration
+	batchSize     int
+)
+
+func init() {
+	ServeCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "file holding the log's private signing key (default ~/.config/tl/log.key)")
+	ServeCmd.Flags().StringVar(&listen, "listen", "localhost:8083", "address to listen on")
+	ServeCmd.Flags().StringVar(&dbFile, "db", "", "database holding the log (default ~/.config/tl/log.badger.db)")
+	ServeCmd.Flags().StringSliceVar(&policy.AllowHosts, "allow-host", nil, "only fetch from these hosts; *.example.com matches subdomains (default any host)")
+	ServeCmd.Flags().StringSliceVar(&policy.DenyHosts, "deny-host", nil, "never fetch from these hosts")
+	ServeCmd.Flags().BoolVar(&policy.AllowPrivate, "allow-private", false, "allow fetching from loopback, private and link-local addresses")
+	ServeCmd.Flags().Int64Var(&policy.MaxSize, "max-size", 0, "refuse assets larger than this many bytes (0 for no limit)")
+	ServeCmd.Flags().DurationVar(&policy.Timeout, "fetch-timeout", 5*time.Minute, "time limit for fetching an asset")
+	ServeCmd.Flags().IntVar(&policy.ClientLimit, "client-limit", 60, "fetches each client may cause per minute (0 for no limit)")
+	ServeCmd.Flags().IntVar(&policy.HostLimit, "host-limit", 600, "fetches from each host per minute (0 for no limit)")
+
+	ServeCmd.Flags().DurationVar(&batchInterval, "batch-interval", time.Second, "longest time a new record waits to be added to the log")
+	ServeCmd.Flags().IntVar(&batchSize, "batch-size", 256, "most records added to the log in one batch")
+
+	ServeCmd.AddCommand(genkeyCmd)
+}
+
+func defaultKeyFile() string {
+	if keyFile == "" {
+		keyFile = filepath.Join(config.Dir(), "log.key")
+	}
+	return keyFile
+}
+
+func genkey(cmd *cobra.Command, args []string) {
+	vkey, err := config.GenerateKey(defaultKeyFile(), args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(vkey)
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	signer, err := config.ReadSigner(defaultKeyFile())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if dbFile == "" {
+		dbFile = filepath.Join(config.Dir(), "log.badger.db")
+	}
+	store, err := badger.Open(dbFile, signer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	seq := sequencer.New(store, batchInterval, batchSize)
+	defer seq.Close()
+
+	mux := http.NewServeMux()
+	srv := sumdb.NewServer(&ingest.Ingester{Store: seq, Policy: &policy})
+	for _, path := range sumdb.ServerPaths {
+		mux.Handle(path, srv)
+	}
+	hs := &http.Server{
+		Addr:    listen,
+		Handler: ingest.ClientHandler(mux),
+
+		// Lookups may download the URL, so there is no write timeout,
+		// but slow or idle clients must not hold connections open.
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	// Shut down cleanly, before the deferred calls
+	// close the sequencer and the database.
+	log.Printf("log %s with %d records serving on http://%s", signer.Name(), store.Size(), listen)
+	if err := config.Serve(cmd.Context(), hs); err != nil {
+		seq.Close()
+		store.Close()
+		log.Fatal(err)
+	}
+}
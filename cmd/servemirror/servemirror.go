@@ -0,0 +1,239 @@
+package servemirror
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/cmd/cat"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var ServeMirrorCmd = &cobra.Command{
+	Use:   "serve-mirror",
+	Short: "Serve verified copies of remote URLs over HTTP",
+	Long: `Serve verified copies of remote URLs over HTTP.
+
+A request for /https/cdn.kernel.org/pub/linux/kernel/v5.x/linux-5.8.tar.xz
+fetches https://cdn.kernel.org/pub/linux/kernel/v5.x/linux-5.8.tar.xz, verifies
+it with the asset transparency log exactly like get, and serves it. Verified
+contents are cached on disk by digest, so later requests for a URL whose log
+record still has the cached contents as its newest digest are served without
+contacting the upstream server.
+
+Contents that cannot be verified are never served. The response has a JSON
+body in the format of --output json describing the failure, and its status is
+404 if the log has no record for the URL, 403 if the log refused to look it
+up, and 502 for any other failure.`,
+
+	Args: cobra.NoArgs,
+
+	Run: serveMirror,
+}
+
+var (
+	listen   string
+	cacheDir string
+	maxSize  int64
+	dbFile   string
+)
+
+func init() {
+	ServeMirrorCmd.Flags().StringVar(&listen, "listen", "localhost:8080", "address to listen on")
+	ServeMirrorCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory for verified contents (default ~/.config/tl/mirror)")
+	ServeMirrorCmd.Flags().Int64Var(&maxSize, "max-size", 0, "refuse URLs with contents larger than this many bytes (0 for no limit)")
+	ServeMirrorCmd.Flags().StringVar(&dbFile, "db", "", "database holding the mirror's log records and tiles (default ~/.config/tl/mirror.badger.db)")
+}
+
+func serveMirror(cmd *cobra.Command, args []string) {
+	if cacheDir == "" {
+		cacheDir = filepath.Join(config.Dir(), "mirror")
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		log.Fatal(err)
+	}
+
+	// The server holds its database for as long as it runs,
+	// so it does not use the one shared by the other commands.
+	if dbFile == "" {
+		dbFile = filepath.Join(config.Dir(), "mirror.badger.db")
+	}
+	cache := config.OpenClientCache(dbFile)
+	defer cache.Close()
+
+	srv := &http.Server{
+		Addr:    listen,
+		Handler: &mirror{client: config.NewClient(cache), dir: cacheDir},
+	}
+
+	// Shut down cleanly so that the log cache is closed.
+	log.Printf("serving verified mirror on http://%s/", listen)
+	if err := config.Serve(cmd.Context(), srv); err != nil {
+		cache.Close()
+		log.Fatal(err)
+	}
+}
+
+// A mirror is an http.Handler serving verified copies of remote URLs.
+type mirror struct {
+	client *sumdb.Client
+	dir    string // directory of verified contents, named by hex sha256
+}
+
+func (m *mirror) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	durl, err := upstreamURL(req)
+	r, rerr := asset.NewResult(durl)
+	if err == nil {
+		err = rerr
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Any error looking up the record is reported by fetch.
+	file, _ := m.cached(req.Context(), r)
+	if file == "" {
+		file, err = m.fetch(req.Context(), r)
+		if err != nil {
+			log.Printf("%s: %v", durl, err)
+			writeError(w, r, statusCode(err), err)
+			return
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+r.Digest+`"`)
+	http.ServeContent(w, req, path.Base(req.URL.Path), fi.ModTime(), f)
+}
+
+// upstreamURL returns the URL mirrored by req,
+// whose path is /scheme/host/path.
+func upstreamURL(req *http.Request) (string, error) {
+	p := strings.TrimPrefix(req.URL.Path, "/")
+	i := strings.Index(p, "/")
+	if i < 0 {
+		return "", fmt.Errorf("%w: path %q must be /http/... or /https/...", asset.ErrUsage, req.URL.Path)
+	}
+	scheme, rest := p[:i], p[i+1:]
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("%w: path %q must be /http/... or /https/...", asset.ErrUsage, req.URL.Path)
+	}
+
+	durl := scheme + "://" + rest
+	if req.URL.RawQuery != "" {
+		durl += "?" + req.URL.RawQuery
+	}
+	return durl, nil
+}
+
+// cached returns the name of a cached file holding the contents
+// whose digest the log recorded most recently for r, as of a fresh
+// lookup, or the empty string if there is none. It does not contact
+// the upstream server.
+func (m *mirror) cached(ctx context.Context, r *asset.Result) (string, error) {
+	id, data, err := m.client.LookupContext(ctx, r.Key, sumdb.LookupOpts{Fresh: true})
+	if err != nil {
+		return "", err
+	}
+	d := asset.ParseRecord(data).Newest()
+	if d == "" {
+		return "", nil
+	}
+	file, err := m.file(d)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(file); err != nil {
+		return "", nil
+	}
+	r.Digest = d
+	r.RecordID = id
+	return file, nil
+}
+
+// fetch downloads and verifies r.URL, stores it in the cache
+// and returns the name of the cached file.
+func (m *mirror) fetch(ctx context.Context, r *asset.Result) (string, error) {
+	f, err := ioutil.TempFile(m.dir, "tmp-")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	err = cat.Fetch(ctx, m.client, r, f, maxSize)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	file, err := m.file(r.Digest)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// file returns the name of the cache file for contents with the given digest.
+func (m *mirror) file(digest string) (string, error) {
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(digest, "h1:"))
+	if err != nil || len(sum) != 32 {
+		return "", errors.New("malformed digest " + digest)
+	}
+	return filepath.Join(m.dir, hex.EncodeToString(sum)), nil
+}
+
+// statusCode returns the status of the response reporting err.
+func statusCode(err error) int {
+	switch asset.ExitCode(err) {
+	case asset.ExitNotFound:
+		return http.StatusNotFound
+	case asset.ExitRefused:
+		return http.StatusForbidden
+	}
+	return http.StatusBadGateway
+}
+
+// writeError writes err as the JSON body of an error response.
+func writeError(w http.ResponseWriter, r *asset.Result, code int, err error) {
+	r.SetError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	r.WriteJSON(w)
+}
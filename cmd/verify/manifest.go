@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// An entry is a single URL and local file pair listed in a manifest.
+type entry struct {
+	url  string
+	file string
+	sum  []byte // digest listed in a sha256sum manifest, if any
+
+	result *asset.Result
+	err    error // result of verifying the entry
+}
+
+// readManifest parses the manifest file.
+// Blank lines and lines starting with # are ignored.
+func readManifest(file, baseURL string) ([]*entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*entry
+	s := bufio.NewScanner(f)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := parseManifestLine(line, baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, lineno, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parseManifestLine parses a single manifest line.
+// Without a base URL the line is "URL path".
+// With a base URL the line is in sha256sum format, "digest path" or
+// "digest *path", and the URL is the base URL joined with the path.
+func parseManifestLine(line, baseURL string) (*entry, error) {
+	if baseURL == "" {
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("malformed manifest line: want URL and file")
+		}
+		return &entry{url: f[0], file: f[1]}, nil
+	}
+
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return nil, fmt.Errorf("malformed sha256sum line")
+	}
+	sum, err := hex.DecodeString(line[:i])
+	if err != nil || len(sum) != 32 {
+		return nil, fmt.Errorf("malformed sha256sum digest %q", line[:i])
+	}
+	name := strings.TrimLeft(line[i:], " \t")
+	name = strings.TrimPrefix(name, "*")
+	if name == "" {
+		return nil, fmt.Errorf("malformed sha256sum line: missing file name")
+	}
+	return &entry{
+		url:  strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(name, "/"),
+		file: name,
+		sum:  sum,
+	}, nil
+}
+
+// verifyEntry checks a single manifest entry against the log.
+func verifyEntry(ctx context.Context, client *sumdb.Client, e *entry) error {
+	r, err := asset.NewResult(e.url)
+	r.File = e.file
+	e.result = r
+	if err != nil {
+		return err
+	}
+	_, err = verifyFile(ctx, client, r, e.sum)
+	return err
+}
+
+// verifyManifest verifies every entry of the manifest concurrently,
+// sharing a single client, and prints a summary of the results.
+// It exits with a non-zero status if any entry fails.
+func verifyManifest(ctx context.Context) {
+	entries, err := readManifest(manifest, baseURL)
+	if err != nil {
+		asset.Fatal(err)
+	}
+
+	cache := config.ClientCache()
+	client := config.NewClient(cache)
+
+	ctx, cancel := config.Context(ctx)
+	defer cancel()
+
+	if jobs < 1 {
+		jobs = 1
+	}
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(e *entry) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			e.err = verifyEntry(ctx, client, e)
+		}(e)
+	}
+	wg.Wait()
+	cache.Close()
+
+	failed := 0
+	var errs []error
+	for _, e := range entries {
+		if e.err != nil {
+			failed++
+			errs = append(errs, e.err)
+		}
+	}
+
+	if config.Output == "json" {
+		for _, e := range entries {
+			e.result.SetError(e.err)
+			e.result.WriteJSON(os.Stdout)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, e := range entries {
+			if e.err != nil {
+				fmt.Fprintf(w, "FAIL\t%s\t%s\t%v\n", e.url, e.file, e.err)
+				continue
+			}
+			fmt.Fprintf(w, "OK\t%s\t%s\t%s\n", e.url, e.file, e.result.Warning())
+		}
+		w.Flush()
+		fmt.Printf("%d verified, %d failed\n", len(entries)-failed, failed)
+	}
+
+	os.Exit(asset.WorstExitCode(errs...))
+}
@@ -1,16 +1,13 @@
 package verify
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"bytes"
+	"context"
 	"fmt"
-	"io"
-	"log"
-	"net/url"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/asset"
 	"go.transparencylog.com/tl/config"
 	"go.transparencylog.com/tl/sumdb"
 )
@@ -18,59 +15,117 @@ import (
 var VerifyCmd = &cobra.Command{
 	Use:   "verify [URL] [file]",
 	Short: "Verify the contents of a locally downloaded file with the asset transparency log",
+	Long: `Verify the contents of a locally downloaded file with the asset transparency log.
 
-	Args: cobra.ExactArgs(2),
+With --manifest, verify every entry listed in a manifest file instead. Each
+line of the manifest is a URL followed by the path of the local file. With
+--base-url, the manifest is read in sha256sum format instead and each URL is
+the base URL followed by the listed file name.
+
+With --offline, the network is never used. Verification succeeds only if the
+log record and every tile needed to authenticate it against the cached tree
+head are already in the local cache.`,
+
+	Args: verifyArgs,
 
 	Run: verify,
 }
 
-func verify(cmd *cobra.Command, args []string) {
-	durl := args[0]
-	file := args[1]
+var (
+	manifest string
+	baseURL  string
+	jobs     int
+	offline  bool
+)
 
-	_ = file
+func init() {
+	VerifyCmd.Flags().StringVar(&manifest, "manifest", "", "verify every URL and file listed in this manifest")
+	VerifyCmd.Flags().StringVar(&baseURL, "base-url", "", "read the manifest in sha256sum format and prefix file names with this URL")
+	VerifyCmd.Flags().IntVarP(&jobs, "jobs", "j", 8, "number of manifest entries to verify concurrently")
+	VerifyCmd.Flags().BoolVar(&offline, "offline", false, "verify using only the local cache, without network access")
+}
 
-	u, err := url.Parse(durl)
+func verifyArgs(cmd *cobra.Command, args []string) error {
+	if manifest != "" {
+		return cobra.NoArgs(cmd, args)
+	}
+	if baseURL != "" {
+		return fmt.Errorf("--base-url requires --manifest")
+	}
+	return cobra.ExactArgs(2)(cmd, args)
+}
+
+func verify(cmd *cobra.Command, args []string) {
+	if manifest != "" {
+		verifyManifest(cmd.Context())
+		return
+	}
+
+	r, err := asset.NewResult(args[0])
+	r.File = args[1]
 	if err != nil {
-		panic(err)
+		fail(r, err)
 	}
-	key := u.Host + u.Path
 
 	cache := config.ClientCache()
-	client := sumdb.NewClient(cache)
+	defer cache.Close()
+	client := config.NewClient(cache)
 
-	// Step 1: Generate sha256sum of the file
-	f, err := os.Open(args[1])
+	ctx, cancel := config.Context(cmd.Context())
+	defer cancel()
+
+	sum, err := verifyFile(ctx, client, r, nil)
 	if err != nil {
-		log.Fatal(err)
+		cache.Close()
+		fail(r, err)
 	}
-	defer f.Close()
 
-	h := sha256.New()
-	_, err = io.Copy(h, f)
+	if config.Output == "json" {
+		r.WriteJSON(os.Stdout)
+		return
+	}
+	fmt.Printf("fetched note: %s/lookup/%s\n", config.ServerURL, r.Key)
+	if w := r.Warning(); w != "" {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	fmt.Printf("validated file sha256sum: %x\n", sum)
+}
+
+// verifyFile checks the local file r.File against the log.
+// If manifestSum is not nil, the file must also match it.
+// verifyFile returns the sha256 sum of the file.
+func verifyFile(ctx context.Context, client *sumdb.Client, r *asset.Result, manifestSum []byte) ([]byte, error) {
+	// Step 1: Generate sha256sum of the file
+	sum, err := sumFile(r.File)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if manifestSum != nil && !bytes.Equal(manifestSum, sum) {
+		r.Digest = asset.Digest(sum)
+		return sum, fmt.Errorf("file sha256sum %x != manifest sha256sum %x", sum, manifestSum)
 	}
 
-	fileSum := h.Sum(nil)
+	// Step 2: Download the tlog entry for the URL and check it
+	return sum, asset.Verify(ctx, client, r, sum, sumdb.LookupOpts{Offline: offline})
+}
 
-	want := "h1:" + base64.StdEncoding.EncodeToString(fileSum)
+// fail reports the failed verification r and exits.
+func fail(r *asset.Result, err error) {
+	if config.Output == "json" {
+		r.SetError(err)
+		r.WriteJSON(os.Stdout)
+		os.Exit(asset.ExitCode(err))
+	}
+	asset.Fatal(err)
+}
 
-	// Step 1: Download the tlog entry for the URL
-	_, data, err := client.LookupOpts(key, sumdb.LookupOpts{Digest: want})
+// sumFile returns the sha256 sum of the named file.
+func sumFile(file string) ([]byte, error) {
+	f, err := os.Open(file)
 	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Printf("fetched note: %s/lookup/%s\n", config.ServerURL, key)
-
-	for _, line := range strings.Split(string(data), "\n") {
-		if line == want {
-			break
-		}
-		if strings.HasPrefix(line, "h1:") {
-			log.Fatalf("file digest %x != log digest %x", fileSum, line)
-		}
+		return nil, err
 	}
+	defer f.Close()
 
-	fmt.Printf("validated file sha256sum: %x\n", fileSum)
+	return asset.Sum(f)
 }
@@ -0,0 +1,138 @@
+package witness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.transparencylog.com/tl/config"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+var WitnessCmd = &cobra.Command{
+	Use:   "witness",
+	Short: "Run a witness that checks and cosigns the log's tree heads",
+	Long: `Run a witness that checks and cosigns the log's tree heads.
+
+A witness polls the log for its latest tree head, checks that it is consistent
+with every tree head the witness has checked before, and serves the latest
+checked tree head with the witness's cosignature appended at /latest. A tree
+head that forks from that history is logged as a security error and never
+cosigned.
+
+Use "tl witness genkey" to create the witness's signing key, and give the
+printed verifier key to the users of the witness for their --witness flag.`,
+}
+
+var genkeyCmd = &cobra.Command{
+	Use:   "genkey [name]",
+	Short: "Generate a witness signing key",
+	Long: `Generate a witness signing key with the given name, such as
+witness.example.com. The private key is written to --key, which must not
+exist, and the verifier key is printed.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: genkey,
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Check and cosign the log's tree heads and serve them over HTTP",
+
+	Args: cobra.NoArgs,
+
+	Run: serve,
+}
+
+var (
+	keyFile  string
+	listen   string
+	interval time.Duration
+	dbFile   string
+)
+
+func init() {
+	WitnessCmd.PersistentFlags().StringVar(&keyFile, "key", "", "file holding the witness's private signing key (default ~/.config/tl/witness.key)")
+
+	serveCmd.Flags().StringVar(&listen, "listen", "localhost:8081", "address to listen on")
+	serveCmd.Flags().DurationVar(&interval, "interval", time.Minute, "how often to poll the log for a new tree head")
+	serveCmd.Flags().StringVar(&dbFile, "db", "", "database holding the witness's checked tree head (default ~/.config/tl/witness.badger.db)")
+
+	WitnessCmd.AddCommand(genkeyCmd)
+	WitnessCmd.AddCommand(serveCmd)
+}
+
+func defaultKeyFile() string {
+	if keyFile == "" {
+		keyFile = filepath.Join(config.Dir(), "witness.key")
+	}
+	return keyFile
+}
+
+func genkey(cmd *cobra.Command, args []string) {
+	vkey, err := config.GenerateKey(defaultKeyFile(), args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(vkey)
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	signer, err := config.ReadSigner(defaultKeyFile())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if dbFile == "" {
+		dbFile = filepath.Join(config.Dir(), "witness.badger.db")
+	}
+	cache := config.OpenClientCache(dbFile)
+	defer cache.Close()
+
+	w := sumdb.NewWitness(cache, signer)
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	go poll(ctx, w)
+
+	srv := &http.Server{
+		Addr:    listen,
+		Handler: w,
+	}
+
+	// Shut down cleanly on interrupt so that the checked tree head is saved.
+	log.Printf("witness %s serving cosigned tree heads of %s on http://%s/latest", signer.Name(), config.ServerURL, listen)
+	if err := config.Serve(ctx, srv); err != nil {
+		cache.Close()
+		log.Fatal(err)
+	}
+}
+
+// poll updates w from the log every interval until ctx is done.
+func poll(ctx context.Context, w *sumdb.Witness) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		uctx, cancel := context.WithTimeout(ctx, interval)
+		err := w.Update(uctx)
+		cancel()
+		switch {
+		case errors.Is(err, sumdb.ErrSecurity):
+			log.Printf("refusing to cosign: %v", err)
+		case err != nil && ctx.Err() == nil:
+			log.Printf("update: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
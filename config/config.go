@@ -1,19 +1,56 @@
 package config
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
+	"go.transparencylog.com/mod/sumdb/note"
 	"go.transparencylog.com/tl/clientcache/badger"
+	"go.transparencylog.com/tl/sumdb"
 )
 
 var Version string
 var Commit string
 var Date string
 
+// Timeout is the time limit for the network operations of a command,
+// set with the --timeout flag. Zero means no limit.
+var Timeout time.Duration
+
+// Output is the output format selected with the --output flag,
+// either "text" or "json".
+var Output string = "text"
+
+// Witnesses are the verifier keys of the witnesses that must cosign the
+// log's tree heads, and WitnessThreshold is how many of them must do so.
+// A negative WitnessThreshold requires all of them. They are set with the
+// TL_WITNESSES and TL_WITNESS_THRESHOLD environment variables or the
+// --witness and --witness-threshold flags.
+var Witnesses []string
+var WitnessThreshold int = -1
+
+// WitnessURLs are the URLs of witness servers, such as those run by
+// tl witness serve, from which clients read the witnesses' cosigned tree
+// heads to accept log tree heads that carry too few cosignatures
+// themselves. They are set with the TL_WITNESS_URLS environment
+// variable or the --witness-url flag.
+var WitnessURLs []string
+
+// Proofs makes clients check records and tree heads with the log's proof
+// endpoints instead of reading tiles. It is set with the TL_PROOFS
+// environment variable or the --proofs flag.
+var Proofs bool
+
 var ServerURL string = "https://beta-asset.transparencylog.net"
 var ServerKey string = "log+3809a75e+ARmkoBH4C+/rbs9QomTtpLJQCkzfY171BfHZLEnmA/+e"
 
@@ -26,10 +63,103 @@ func init() {
 	if s != "" {
 		ServerKey = s
 	}
+	Witnesses = strings.Fields(os.Getenv("TL_WITNESSES"))
+	WitnessURLs = strings.Fields(os.Getenv("TL_WITNESS_URLS"))
+	s = os.Getenv("TL_WITNESS_THRESHOLD")
+	if s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatalf("invalid TL_WITNESS_THRESHOLD: %v", err)
+		}
+		WitnessThreshold = n
+	}
+	s = os.Getenv("TL_PROOFS")
+	if s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			log.Fatalf("invalid TL_PROOFS: %v", err)
+		}
+		Proofs = b
+	}
 }
 
-// ClientCache returns an initialized ClientCache using ServerURL and ServerKey
-func ClientCache() *badger.ClientCache {
+// NewClient returns a new sumdb.Client using ops
+// that enforces the configured witness policy
+// and uses proof mode if Proofs is set.
+func NewClient(ops sumdb.ClientOps) *sumdb.Client {
+	client := sumdb.NewClient(ops)
+	if len(Witnesses) > 0 {
+		k := WitnessThreshold
+		if k < 0 {
+			k = len(Witnesses)
+		}
+		client.SetWitnesses(k, Witnesses)
+		var remotes []sumdb.Remote
+		for _, u := range WitnessURLs {
+			remotes = append(remotes, sumdb.NewRemote(u))
+		}
+		client.SetWitnessRemotes(remotes)
+	}
+	if Proofs {
+		client.SetProofMode()
+	}
+	return client
+}
+
+// CheckWitnesses checks that the configured witness keys
+// are valid and the threshold can be met.
+func CheckWitnesses() error {
+	for _, key := range Witnesses {
+		if _, err := note.NewVerifier(key); err != nil {
+			return fmt.Errorf("invalid witness key %q: %v", key, err)
+		}
+	}
+	if WitnessThreshold > len(Witnesses) {
+		return fmt.Errorf("witness threshold %d exceeds the %d witness keys", WitnessThreshold, len(Witnesses))
+	}
+	return nil
+}
+
+// Context returns a context derived from parent
+// that is canceled once Timeout has passed, if it is set.
+func Context(parent context.Context) (context.Context, context.CancelFunc) {
+	if Timeout > 0 {
+		return context.WithTimeout(parent, Timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// shutdownTimeout is how long Serve waits for the requests
+// in progress to finish once it starts shutting down.
+const shutdownTimeout = 30 * time.Second
+
+// Serve runs srv until ctx is done, then shuts it down, waiting up to
+// shutdownTimeout for the requests in progress to finish before it closes
+// the remaining connections and returns. It returns nil after a clean
+// shutdown.
+func Serve(ctx context.Context, srv *http.Server) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(sctx)
+	if err != nil {
+		srv.Close()
+		err = fmt.Errorf("shutting down: %w", err)
+	}
+	<-errc
+	return err
+}
+
+// Dir returns the tl configuration directory, creating it if necessary.
+func Dir() string {
 	home, err := homedir.Dir()
 	if err != nil {
 		fmt.Println(err)
@@ -42,14 +172,123 @@ func ClientCache() *badger.ClientCache {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	return tlDir
+}
+
+// GenerateKey generates a signing key with the given name, such as
+// log.example.com, writes it to file, which must not exist, and returns
+// its verifier key.
+func GenerateKey(file, name string) (vkey string, err error) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, name)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fmt.Fprintln(f, skey); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return vkey, nil
+}
+
+// ReadSigner returns a signer for the signing key in file,
+// as written by GenerateKey.
+func ReadSigner(file string) (note.Signer, error) {
+	skey, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := note.NewSigner(strings.TrimSpace(string(skey)))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", file, err)
+	}
+	return signer, nil
+}
+
+// EvidenceDir returns the directory in which evidence
+// of log server misbehavior is saved.
+func EvidenceDir() string {
+	return filepath.Join(Dir(), "evidence")
+}
+
+// TrustFile returns the path of the trust configuration, which lists
+// the log's verifier keys and when each may sign tree heads.
+func TrustFile() string {
+	return filepath.Join(Dir(), "trust")
+}
+
+// Trust returns the configured trust in the log's keys: ServerKey if it
+// was set with TL_DEBUG_SERVERKEY, otherwise the contents of TrustFile
+// if it exists, otherwise ServerKey.
+func Trust() ([]byte, error) {
+	if os.Getenv("TL_DEBUG_SERVERKEY") == "" {
+		data, err := ioutil.ReadFile(TrustFile())
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return []byte(ServerKey + "\n"), nil
+}
+
+// LogVerifiers returns verifiers for all the log keys in the configured
+// trust, regardless of their validity windows.
+func LogVerifiers() ([]note.Verifier, error) {
+	trust, err := Trust()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := sumdb.ParseTrust(trust)
+	if err != nil {
+		return nil, err
+	}
+	var list []note.Verifier
+	for _, k := range keys {
+		v, err := note.NewVerifier(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
 
-	cacheFile := filepath.Join(tlDir, "tl.badger.db")
+// ClientCache returns an initialized ClientCache using ServerURL and Trust
+func ClientCache() *badger.ClientCache {
+	return OpenClientCache(filepath.Join(Dir(), "tl.badger.db"))
+}
+
+// OpenClientCache returns an initialized ClientCache stored in cacheFile
+// using ServerURL and Trust. If the log keys in the cache differ from the
+// configured trust, it warns and replaces them.
+func OpenClientCache(cacheFile string) *badger.ClientCache {
+	trust, err := Trust()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := sumdb.ParseTrust(trust); err != nil {
+		log.Fatalf("%s: %v", TrustFile(), err)
+	}
 
 	// Initialize cache DB, if necessary
 	cache := badger.NewClientCache(cacheFile, ServerURL)
-	_, err = cache.ReadConfig("key")
+	cache.SetEvidenceDir(EvidenceDir())
+	old, err := cache.ReadConfig("key")
 	if err != nil {
-		if err := cache.WriteConfig("key", nil, []byte(ServerKey)); err != nil {
+		if err := cache.WriteConfig("key", nil, trust); err != nil {
+			log.Fatal(err)
+		}
+	} else if strings.TrimSpace(string(old)) != strings.TrimSpace(string(trust)) {
+		log.Printf("warning: cached log keys differ from configured trust; using configured trust\ncached:\n%s\nconfigured:\n%s", old, trust)
+		if err := cache.WriteConfig("key", old, trust); err != nil {
 			log.Fatal(err)
 		}
 	}
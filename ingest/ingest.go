@@ -0,0 +1,279 @@
+// Package ingest adds records to an asset transparency log
+// for the URLs it is asked about for the first time.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// A Store is a log that records can be appended to.
+// It is implemented by logstore/badger.Store and sequencer.Sequencer.
+type Store interface {
+	sumdb.ServerOps
+
+	// Append adds a record holding data to the log,
+	// as the latest record for key, and returns its ID.
+	// If the record is queued to be added later, Append
+	// returns a *sumdb.PendingError, as Lookup does until then.
+	Append(ctx context.Context, key string, data []byte) (int64, error)
+}
+
+// An Ingester is a sumdb.ServerOps that serves the log in Store.
+// When asked to look up a key the log has no record for, it treats the
+// key as a host and path, fetches "https://" + key, and appends a record
+// holding the key and the "h1:" digest of the contents. It implements
+// sumdb.DigestServerOps, so a lookup for a digest the record does not hold
+// appends the digest if the contents have changed.
+type Ingester struct {
+	Store
+
+	// Client is the HTTP client used to fetch assets.
+	// If nil, a client enforcing Policy is used,
+	// or http.DefaultClient if Policy is nil too.
+	// A Client that is set is used as is: Policy still checks the
+	// host of each key, but not the hosts of redirects or the
+	// addresses dialed, so the Client must refuse those itself.
+	Client *http.Client
+
+	// Policy, if not nil, restricts the assets fetched.
+	Policy *Policy
+
+	mu    sync.Mutex
+	calls map[string]*call // fetches in progress, by key
+}
+
+// A call is a fetch and append of a key in progress.
+// Lookups of the key wait for done and share its result.
+type call struct {
+	done chan struct{}
+	id   int64
+	err  error
+}
+
+// Lookup returns the ID of the latest record for key,
+// fetching the asset and appending a record for it if there is none.
+// Concurrent lookups of the same new key fetch it only once,
+// and a lookup that gives up does not stop the fetch for the others.
+// If the asset does not exist, Lookup returns an error
+// satisfying os.IsNotExist.
+func (g *Ingester) Lookup(ctx context.Context, key string) (int64, error) {
+	id, err := g.Store.Lookup(ctx, key)
+	if !os.IsNotExist(err) {
+		return id, err
+	}
+	return g.do(ctx, key, func(ctx context.Context) (int64, error) { return g.ingest(ctx, key) })
+}
+
+// LookupDigest is like Lookup, but if the latest record for key does not
+// hold digest, it fetches the asset again. If the contents have changed
+// since the record was made, it appends a new record for key holding the
+// record's digests followed by the new one, and returns its ID.
+func (g *Ingester) LookupDigest(ctx context.Context, key, digest string) (int64, error) {
+	id, err := g.Lookup(ctx, key)
+	if err != nil || !asset.ValidDigest(digest) {
+		return id, err
+	}
+	data, err := g.record(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if asset.ParseRecord(data).Index(digest) >= 0 {
+		return id, nil
+	}
+	return g.do(ctx, key, func(ctx context.Context) (int64, error) { return g.refresh(ctx, key, digest) })
+}
+
+// do calls f, unless a call for key is already in progress,
+// and returns its result. Lookups that find a call in progress
+// wait for it and share its result. The call is not canceled when
+// ctx is done, since other lookups may be waiting for it, but it
+// is limited by the Policy's Timeout. It keeps the values of ctx,
+// such as the client identified by WithClient.
+func (g *Ingester) do(ctx context.Context, key string, f func(context.Context) (int64, error)) (int64, error) {
+	g.mu.Lock()
+	c := g.calls[key]
+	if c == nil {
+		c = &call{done: make(chan struct{})}
+		if g.calls == nil {
+			g.calls = make(map[string]*call)
+		}
+		g.calls[key] = c
+		cctx, cancel := context.WithCancel(detach(ctx))
+		if p := g.Policy; p != nil && p.Timeout > 0 {
+			cctx, cancel = context.WithTimeout(cctx, p.Timeout)
+		}
+		go func() {
+			defer cancel()
+			c.id, c.err = f(cctx)
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.id, c.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// A detached context has the values of its parent,
+// but is never canceled and has no deadline.
+type detached struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// ingest fetches the asset for key and appends a record for it,
+// unless a record was appended since the caller looked.
+func (g *Ingester) ingest(ctx context.Context, key string) (int64, error) {
+	if id, err := g.Store.Lookup(ctx, key); !os.IsNotExist(err) {
+		return id, err
+	}
+	d, err := g.fetch(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return g.Store.Append(ctx, key, []byte(key+"\n"+d+"\n"))
+}
+
+// refresh fetches the asset for key again and, if its digest is not the
+// newest one in the latest record for key, appends a new record with the
+// digest added. It does not fetch the asset if a record holding digest
+// was appended since the caller looked.
+func (g *Ingester) refresh(ctx context.Context, key, digest string) (int64, error) {
+	id, err := g.Store.Lookup(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	data, err := g.record(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	rec := asset.ParseRecord(data)
+	if rec.Index(digest) >= 0 {
+		return id, nil
+	}
+	d, err := g.fetch(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if d == rec.Newest() {
+		return id, nil
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	return g.Store.Append(ctx, key, append(data, d+"\n"...))
+}
+
+// record returns the data of record id.
+func (g *Ingester) record(ctx context.Context, id int64) ([]byte, error) {
+	records, err := g.Store.ReadRecords(ctx, id, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, fmt.Errorf("reading record %d: got %d records", id, len(records))
+	}
+	// Copy the record, which may be held by the Store.
+	return append([]byte(nil), records[0]...), nil
+}
+
+// fetch fetches the asset for key and returns its digest.
+func (g *Ingester) fetch(ctx context.Context, key string) (string, error) {
+	u, err := url.Parse("https://" + key)
+	if err != nil {
+		return "", &os.PathError{Op: "fetch", Path: key, Err: os.ErrNotExist}
+	}
+	if u.User != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: invalid host in %s", sumdb.ErrRefused, key)
+	}
+
+	client := g.Client
+	p := g.Policy
+	if p != nil {
+		if err := p.checkHost(u.Hostname()); err != nil {
+			return "", err
+		}
+		if err := p.allow(ctx, u.Hostname()); err != nil {
+			return "", err
+		}
+		if client == nil {
+			client = p.client()
+		}
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return "", &os.PathError{Op: "fetch", Path: key, Err: os.ErrNotExist}
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("fetching https://%s: %s", key, resp.Status)
+	}
+	var body io.Reader = resp.Body
+	if p != nil && p.MaxSize > 0 {
+		if resp.ContentLength > p.MaxSize {
+			return "", fmt.Errorf("%w: https://%s is larger than %d bytes", sumdb.ErrRefused, key, p.MaxSize)
+		}
+		body = &maxReader{r: resp.Body, n: p.MaxSize}
+	}
+	sum, err := asset.Sum(body)
+	if errors.Is(err, sumdb.ErrRefused) {
+		return "", fmt.Errorf("%w: https://%s is larger than %d bytes", sumdb.ErrRefused, key, p.MaxSize)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching https://%s: %v", key, err)
+	}
+	return asset.Digest(sum), nil
+}
+
+// A maxReader reads from r, failing with sumdb.ErrRefused
+// once more than n bytes have been read.
+type maxReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return n, sumdb.ErrRefused
+	}
+	return n, err
+}
@@ -0,0 +1,215 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/logstore/badger/badgertest"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+func TestIngester(t *testing.T) {
+	ctx := context.Background()
+	store := badgertest.NewStore(t)
+
+	var fetches int32
+	started, release := make(chan bool), make(chan bool)
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if r.URL.Path == "/slow.txt" {
+			started <- true
+			<-release
+			w.Write([]byte("slow\n"))
+			return
+		}
+		if r.URL.Path != "/asset.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(50 * time.Millisecond) // let the lookups pile up
+		w.Write([]byte("hello\n"))
+	}))
+	defer origin.Close()
+	host := strings.TrimPrefix(origin.URL, "https://")
+
+	g := &Ingester{Store: store, Client: origin.Client()}
+
+	// Concurrent lookups of a new key fetch it once.
+	key := host + "/asset.txt"
+	var wg sync.WaitGroup
+	ids := make([]int64, 10)
+	errs := make([]error, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = g.Lookup(ctx, key)
+		}(i)
+	}
+	wg.Wait()
+	for i := range ids {
+		if errs[i] != nil || ids[i] != 0 {
+			t.Fatalf("Lookup %d = %d, %v, want 0", i, ids[i], errs[i])
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+
+	records, err := store.ReadRecords(ctx, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello\n"))
+	if want := key + "\n" + asset.Digest(sum[:]) + "\n"; string(records[0]) != want {
+		t.Fatalf("record = %q, want %q", records[0], want)
+	}
+
+	// Known keys are not fetched again.
+	if id, err := g.Lookup(ctx, key); err != nil || id != 0 {
+		t.Fatalf("second Lookup = %d, %v, want 0", id, err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+
+	// Missing assets are not found, and not recorded.
+	if _, err := g.Lookup(ctx, host+"/missing.txt"); !os.IsNotExist(err) {
+		t.Fatalf("Lookup of missing asset: err = %v, want not exist", err)
+	}
+	if store.Size() != 1 {
+		t.Fatalf("log has %d records, want 1", store.Size())
+	}
+
+	// A lookup that gives up does not stop the fetch
+	// for the lookups waiting for it.
+	cctx, cancel := context.WithCancel(ctx)
+	errc := make(chan error)
+	go func() {
+		_, err := g.Lookup(cctx, host+"/slow.txt")
+		errc <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.Lookup(ctx, host+"/slow.txt")
+		errc <- err
+	}()
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("canceled Lookup: err = %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatalf("waiting Lookup: %v", err)
+	}
+	if store.Size() != 2 {
+		t.Fatalf("log has %d records, want 2", store.Size())
+	}
+}
+
+func TestIngesterChange(t *testing.T) {
+	ctx := context.Background()
+	store := badgertest.NewStore(t)
+
+	var mu sync.Mutex
+	var fetches int
+	content := "v1\n"
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Write([]byte(content))
+	}))
+	defer origin.Close()
+	key := strings.TrimPrefix(origin.URL, "https://") + "/asset.txt"
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return asset.Digest(sum[:])
+	}
+
+	// lookup looks up key with the digest h using the HTTP server
+	// and returns the record data.
+	srv := sumdb.NewServer(&Ingester{Store: store, Client: origin.Client()})
+	lookup := func(h string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("GET", "/lookup/"+key+"?h="+url.QueryEscape(h), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("lookup: %d %s", w.Code, w.Body.String())
+		}
+		_, text, _, err := tlog.ParseRecord(w.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(text)
+	}
+	wantFetches := func(n int) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if fetches != n {
+			t.Fatalf("fetched %d times, want %d", fetches, n)
+		}
+	}
+
+	v1 := key + "\n" + digest("v1\n") + "\n"
+	if text := lookup(digest("v1\n")); text != v1 {
+		t.Fatalf("record = %q, want %q", text, v1)
+	}
+	wantFetches(1)
+
+	// A digest the record holds needs no fetch.
+	lookup(digest("v1\n"))
+	wantFetches(1)
+
+	// An unknown digest for unchanged content adds nothing.
+	if text := lookup(digest("other\n")); text != v1 {
+		t.Fatalf("record = %q, want %q", text, v1)
+	}
+	wantFetches(2)
+
+	// Changed content is appended to the digest history.
+	mu.Lock()
+	content = "v2\n"
+	mu.Unlock()
+	v2 := v1 + digest("v2\n") + "\n"
+	if text := lookup(digest("v2\n")); text != v2 {
+		t.Fatalf("record = %q, want %q", text, v2)
+	}
+	wantFetches(3)
+	if id, err := store.Lookup(ctx, key); err != nil || id != 1 {
+		t.Fatalf("Lookup = %d, %v, want 1", id, err)
+	}
+	if err := asset.Check([]byte(v2), digest("v2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := asset.Check([]byte(v2), digest("v1\n")); err != nil {
+		t.Fatalf("Check of older digest: %v", err)
+	}
+
+	// Content that reverts to an earlier version is recorded
+	// again, as the newest digest.
+	mu.Lock()
+	content = "v1\n"
+	mu.Unlock()
+	v3 := v2 + digest("v1\n") + "\n"
+	if text := lookup(digest("other\n")); text != v3 {
+		t.Fatalf("record = %q, want %q", text, v3)
+	}
+	wantFetches(4)
+	rec := asset.ParseRecord([]byte(v3))
+	if i := rec.Index(digest("v1\n")); i != len(rec.Digests)-1 {
+		t.Fatalf("Index of reverted digest = %d, want newest %d", i, len(rec.Digests)-1)
+	}
+}
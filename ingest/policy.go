@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// A Policy restricts the assets an Ingester fetches.
+// Fetches it refuses fail with an error wrapping sumdb.ErrRefused,
+// and fetches beyond its rate limits with sumdb.ErrRateLimited.
+type Policy struct {
+	// AllowHosts, if not empty, lists the only hosts that may be fetched.
+	// DenyHosts lists hosts that may not be fetched, even if allowed.
+	// A pattern "example.com" matches only that host, and a pattern
+	// "*.example.com" matches its subdomains but not example.com.
+	AllowHosts []string
+	DenyHosts  []string
+
+	// AllowPrivate allows fetching from loopback, private,
+	// link-local and other non-public addresses.
+	// By default they are refused, after DNS resolution,
+	// so that lookups cannot reach the server's own network.
+	// The check is made by the Policy's own HTTP client,
+	// so it does not apply if the Ingester's Client is set.
+	AllowPrivate bool
+
+	// MaxSize, if positive, is the largest asset fetched, in bytes.
+	MaxSize int64
+
+	// Timeout, if positive, limits the time of each fetch
+	// and of appending its record.
+	Timeout time.Duration
+
+	// ClientLimit and HostLimit, if positive, are the number of fetches
+	// a client may cause, and a host may receive, in each Period.
+	// Clients are identified by WithClient. The Period defaults to a minute.
+	ClientLimit int
+	HostLimit   int
+	Period      time.Duration
+
+	mu      sync.Mutex
+	clients limiter
+	hosts   limiter
+	hc      *http.Client
+}
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx identifying the client
+// whose lookup is served with ctx, for the Policy's ClientLimit.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientHandler returns a handler that serves h, identifying the
+// client of each request by its IP address for the Policy's ClientLimit.
+func ClientHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+		h.ServeHTTP(w, r.WithContext(WithClient(r.Context(), client)))
+	})
+}
+
+// checkHost checks that host, without a port, may be fetched.
+func (p *Policy) checkHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pat := range p.DenyHosts {
+		if matchHost(pat, host) {
+			return fmt.Errorf("%w: host %s is denied", sumdb.ErrRefused, host)
+		}
+	}
+	if len(p.AllowHosts) == 0 {
+		return nil
+	}
+	for _, pat := range p.AllowHosts {
+		if matchHost(pat, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %s is not allowed", sumdb.ErrRefused, host)
+}
+
+// matchHost reports whether host matches the pattern pat.
+func matchHost(pat, host string) bool {
+	pat = strings.ToLower(pat)
+	if strings.HasPrefix(pat, "*.") {
+		return strings.HasSuffix(host, pat[1:])
+	}
+	return host == pat
+}
+
+// allow reports whether a fetch of host caused by the client of ctx
+// is within the rate limits, and if so counts it.
+func (p *Policy) allow(ctx context.Context, host string) error {
+	period := p.Period
+	if period <= 0 {
+		period = time.Minute
+	}
+	client, _ := ctx.Value(clientKey{}).(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.ClientLimit > 0 && client != "" && !p.clients.allow(client, p.ClientLimit, period, now) {
+		return fmt.Errorf("%w: too many fetches by %s", sumdb.ErrRateLimited, client)
+	}
+	if p.HostLimit > 0 && !p.hosts.allow(host, p.HostLimit, period, now) {
+		return fmt.Errorf("%w: too many fetches from %s", sumdb.ErrRateLimited, host)
+	}
+	return nil
+}
+
+// A limiter is a set of token buckets, by name.
+type limiter map[string]*bucket
+
+// A bucket holds the tokens available at time t.
+type bucket struct {
+	tokens float64
+	t      time.Time
+}
+
+// maxBuckets is the number of buckets above which
+// a limiter drops the ones that have refilled.
+const maxBuckets = 10000
+
+// allow takes a token from the bucket for name, which holds up to
+// n tokens and refills at n per period, and reports whether it had one.
+func (l *limiter) allow(name string, n int, period time.Duration, now time.Time) bool {
+	if *l == nil {
+		*l = make(limiter)
+	}
+	refill := func(b *bucket) {
+		b.tokens += float64(n) * float64(now.Sub(b.t)) / float64(period)
+		if b.tokens > float64(n) {
+			b.tokens = float64(n)
+		}
+		b.t = now
+	}
+	if len(*l) > maxBuckets {
+		for k, b := range *l {
+			if refill(b); b.tokens >= float64(n) {
+				delete(*l, k)
+			}
+		}
+	}
+	b := (*l)[name]
+	if b == nil {
+		b = &bucket{tokens: float64(n), t: now}
+		(*l)[name] = b
+	}
+	refill(b)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// client returns an HTTP client that fetches according to p.
+// Unless p.AllowPrivate is set, it refuses to connect to non-public
+// addresses, checking the address actually dialed so that neither DNS
+// answers nor redirects can lead it elsewhere. It checks the hosts of
+// redirects against the host lists.
+func (p *Policy) client() *http.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hc == nil {
+		p.hc = p.newClient()
+	}
+	return p.hc
+}
+
+func (p *Policy) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !p.AllowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("%w: address %s is not public", sumdb.ErrRefused, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to %s", sumdb.ErrRefused, req.URL.Scheme)
+			}
+			return p.checkHost(req.URL.Hostname())
+		},
+	}
+}
+
+// nonPublic lists the address ranges that are not on the public internet.
+var nonPublic []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "this" network
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier-grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link-local
+		"172.16.0.0/12",  // private
+		"192.0.0.0/24",   // IETF protocol assignments
+		"192.168.0.0/16", // private
+		"198.18.0.0/15",  // benchmarking
+		"224.0.0.0/4",    // multicast
+		"240.0.0.0/4",    // reserved and broadcast
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"64:ff9b::/96",   // IPv4/IPv6 translation, which may reach private IPv4
+		"64:ff9b:1::/48", // local-use IPv4/IPv6 translation
+		"2001::/32",      // Teredo, which embeds an IPv4 address
+		"2002::/16",      // 6to4, which embeds an IPv4 address
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link-local
+		"ff00::/8",       // multicast
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nonPublic = append(nonPublic, n)
+	}
+}
+
+// publicIP reports whether ip is on the public internet.
+func publicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range nonPublic {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
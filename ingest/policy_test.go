@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/logstore/badger/badgertest"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+func TestPolicy(t *testing.T) {
+	store := badgertest.NewStore(t)
+
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer origin.Close()
+	host := strings.TrimPrefix(origin.URL, "https://")
+
+	// lookup looks up path on the origin from the client at addr
+	// and returns the HTTP status of the response.
+	lookup := func(g *Ingester, addr, path string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/lookup/"+host+path, nil)
+		req.RemoteAddr = addr + ":1234"
+		w := httptest.NewRecorder()
+		ClientHandler(sumdb.NewServer(g)).ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, tt := range []struct {
+		name   string
+		policy *Policy
+		client *http.Client
+		path   string
+		code   int
+	}{
+		{"loopback", &Policy{}, nil, "/a", http.StatusForbidden},
+		{"not allowed", &Policy{AllowPrivate: true, AllowHosts: []string{"*.example.com"}}, origin.Client(), "/b", http.StatusForbidden},
+		{"denied", &Policy{AllowPrivate: true, DenyHosts: []string{"127.0.0.1"}}, origin.Client(), "/c", http.StatusForbidden},
+		{"too large", &Policy{AllowPrivate: true, MaxSize: 99}, origin.Client(), "/d", http.StatusForbidden},
+		{"allowed", &Policy{AllowPrivate: true, AllowHosts: []string{"127.0.0.1"}, MaxSize: 100}, origin.Client(), "/e", http.StatusOK},
+	} {
+		g := &Ingester{Store: store, Client: tt.client, Policy: tt.policy}
+		if code := lookup(g, "192.0.2.1", tt.path); code != tt.code {
+			t.Errorf("%s: lookup status %d, want %d", tt.name, code, tt.code)
+		}
+	}
+
+	// Each client may cause ClientLimit fetches, and each host
+	// may receive HostLimit, but known keys are not limited.
+	g := &Ingester{Store: store, Client: origin.Client(), Policy: &Policy{AllowPrivate: true, ClientLimit: 2, HostLimit: 3}}
+	for _, tt := range []struct {
+		addr string
+		path string
+		code int
+	}{
+		{"192.0.2.1", "/1", http.StatusOK},
+		{"192.0.2.1", "/2", http.StatusOK},
+		{"192.0.2.1", "/3", http.StatusTooManyRequests},
+		{"192.0.2.1", "/1", http.StatusOK},
+		{"192.0.2.2", "/3", http.StatusOK},
+		{"192.0.2.2", "/4", http.StatusTooManyRequests},
+	} {
+		if code := lookup(g, tt.addr, tt.path); code != tt.code {
+			t.Errorf("lookup of %s by %s: status %d, want %d", tt.path, tt.addr, code, tt.code)
+		}
+	}
+
+	// Clients can tell refusals apart from missing records.
+	var err error = &sumdb.RemoteError{Path: "/lookup/" + host + "/a", StatusCode: http.StatusForbidden, Status: "403 Forbidden"}
+	if !errors.Is(err, sumdb.ErrRefused) || errors.Is(err, sumdb.ErrNotFound) || asset.ExitCode(err) != asset.ExitRefused {
+		t.Errorf("403 lookup error is not a refusal")
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for _, tt := range []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"10.1.2.3", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"::ffff:127.0.0.1", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::7f00:1", false},
+		{"2002:7f00:1::1", false},
+		{"2002:a00:1::1", false},
+		{"2001:0:4136:e378:8000:63bf:f5ff:fffe", false}, // Teredo for 10.0.0.1
+		{"2001:4860:4860::8888", true},
+	} {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
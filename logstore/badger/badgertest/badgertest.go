@@ -0,0 +1,65 @@
+// Package badgertest provides logs stored in badger databases for tests.
+package badgertest
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/tl/logstore/badger"
+)
+
+// A Store is a badger.Store for a test log,
+// along with the directory and keys of the log.
+type Store struct {
+	*badger.Store
+
+	Dir         string
+	Signer      note.Signer
+	SignerKey   string
+	VerifierKey string
+}
+
+// NewStore returns a Store for a new log named "log.localdev"
+// in a temporary directory. The Store is closed and the directory
+// removed when the test finishes.
+func NewStore(t testing.TB) *Store {
+	t.Helper()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "tl-badgertest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s := &Store{Dir: dir, Signer: signer, SignerKey: skey, VerifierKey: vkey}
+	s.Store, err = badger.Open(dir, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Store.Close() })
+	return s
+}
+
+// Reopen closes the Store and opens its database again,
+// as a log server does when it restarts.
+func (s *Store) Reopen(t testing.TB) {
+	t.Helper()
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	s.Store, err = badger.Open(s.Dir, s.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,301 @@
+// Package badger implements sumdb.ServerOps on a badger database,
+// so that a log server keeps its records across restarts.
+package badger
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v2"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+// The database holds:
+//
+//	record/<id>   the data of record id
+//	hash/<index>  the stored hash with the given index
+//	key/<key>     the ID of the latest record for key
+//	size          the number of records in the log
+//	latest        the signed tree head for size
+//
+// IDs and indexes are 8-byte big-endian integers,
+// so that records and hashes are stored in order.
+const (
+	recordPrefix = "record/"
+	hashPrefix   = "hash/"
+	keyPrefix    = "key/"
+	sizeKey      = "size"
+	latestKey    = "latest"
+)
+
+// A Store is a log stored in a badger database.
+// It implements sumdb.ServerOps.
+type Store struct {
+	bdb    *badger.DB
+	signer note.Signer
+
+	mu     sync.Mutex // serializes appends
+	size   int64
+	signed []byte
+}
+
+// Open opens the log stored in the database directory dir,
+// creating it if necessary. The log's tree heads are signed by signer,
+// and Open signs the current tree head again, so that a new key takes
+// effect on restart.
+func Open(dir string, signer note.Signer) (*Store, error) {
+	bdb, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{bdb: bdb, signer: signer}
+	err = bdb.Update(func(tx *badger.Txn) error {
+		var err error
+		if s.size, err = committedSize(tx); err != nil {
+			return err
+		}
+		s.signed, err = s.sign(tx, s.size)
+		return err
+	})
+	if err != nil {
+		bdb.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.bdb.Close()
+}
+
+// Signed returns the signed tree head of the latest tree.
+func (s *Store) Signed(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signed, nil
+}
+
+// Size returns the number of records in the log.
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// ReadRecords returns the content for the n records id through id+n-1.
+// It returns an error satisfying os.IsNotExist if they are not all in the log.
+func (s *Store) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	var list [][]byte
+	err := s.bdb.View(func(tx *badger.Txn) error {
+		// The keys of appended records are visible once the append
+		// commits, before AppendBatch updates s.size, so check against
+		// the size committed with them: a record found by Lookup can
+		// always be read.
+		size, err := committedSize(tx)
+		if err != nil {
+			return err
+		}
+		if id < 0 || n < 0 || id+n > size {
+			return &os.PathError{Op: "read", Path: fmt.Sprintf("records %d-%d", id, id+n-1), Err: os.ErrNotExist}
+		}
+		for i := int64(0); i < n; i++ {
+			data, err := get(tx, indexKey(recordPrefix, id+i))
+			if err != nil {
+				return fmt.Errorf("reading record %d: %v", id+i, err)
+			}
+			list = append(list, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Lookup returns the ID of the latest record for key.
+// It returns an error satisfying os.IsNotExist if there is none.
+func (s *Store) Lookup(ctx context.Context, key string) (int64, error) {
+	var id int64
+	err := s.bdb.View(func(tx *badger.Txn) error {
+		data, err := get(tx, []byte(keyPrefix+key))
+		if err != nil {
+			return err
+		}
+		if len(data) != 8 {
+			return fmt.Errorf("invalid record ID for %s", key)
+		}
+		id = int64(binary.BigEndian.Uint64(data))
+		return nil
+	})
+	if err == badger.ErrKeyNotFound {
+		return 0, &os.PathError{Op: "lookup", Path: key, Err: os.ErrNotExist}
+	}
+	return id, err
+}
+
+// ReadTileData reads the content of the hash tile t.
+// It returns an error satisfying os.IsNotExist if t is not in the log.
+func (s *Store) ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	return tlog.ReadTileData(t, hashReader{s: s, n: tlog.StoredHashCount(s.Size())})
+}
+
+// Append adds a record holding data to the log, as the latest record
+// for key, and signs the new tree head. It returns the record's ID.
+func (s *Store) Append(ctx context.Context, key string, data []byte) (int64, error) {
+	return s.AppendBatch(ctx, []string{key}, [][]byte{data})
+}
+
+// AppendBatch adds records holding data[i] to the log, as the latest
+// records for keys[i], in a single transaction, and signs the new tree
+// head once. It returns the ID of the first record; the others follow
+// it in order.
+func (s *Store) AppendBatch(ctx context.Context, keys []string, data [][]byte) (int64, error) {
+	if len(keys) != len(data) {
+		return 0, errors.New("mismatched keys and records")
+	}
+	for _, key := range keys {
+		if key == "" {
+			return 0, errors.New("empty record key")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := s.size
+	var signed []byte
+	err := s.bdb.Update(func(tx *badger.Txn) error {
+		for i, key := range keys {
+			id := start + int64(i)
+			hr := hashReader{s: s, n: tlog.StoredHashCount(id), tx: tx}
+			hashes, err := tlog.StoredHashesForRecordHash(id, tlog.RecordHash(data[i]), hr)
+			if err != nil {
+				return err
+			}
+			index := tlog.StoredHashIndex(0, id)
+			for j := range hashes {
+				// Set keeps the slice until the commit,
+				// so it must not alias the loop variable.
+				if err := tx.Set(indexKey(hashPrefix, index+int64(j)), hashes[j][:]); err != nil {
+					return err
+				}
+			}
+			if err := tx.Set(indexKey(recordPrefix, id), data[i]); err != nil {
+				return err
+			}
+			if err := tx.Set([]byte(keyPrefix+key), indexKey("", id)); err != nil {
+				return err
+			}
+		}
+		var err error
+		signed, err = s.sign(tx, start+int64(len(keys)))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.size = start + int64(len(keys))
+	s.signed = signed
+	return start, nil
+}
+
+// sign signs the tree of the given size, reading hashes using tx,
+// stores the size and signed tree head in tx and returns the signed
+// tree head.
+func (s *Store) sign(tx *badger.Txn, size int64) ([]byte, error) {
+	h, err := tlog.TreeHash(size, hashReader{s: s, n: tlog.StoredHashCount(size), tx: tx})
+	if err != nil {
+		return nil, err
+	}
+	msg, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: size, Hash: h}))}, s.signer)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Set([]byte(sizeKey), []byte(strconv.FormatInt(size, 10))); err != nil {
+		return nil, err
+	}
+	if err := tx.Set([]byte(latestKey), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// hashReader reads the first n stored hashes of s,
+// using tx if it is not nil. It implements tlog.HashReader.
+type hashReader struct {
+	s  *Store
+	n  int64
+	tx *badger.Txn
+}
+
+func (r hashReader) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	list := make([]tlog.Hash, len(indexes))
+	read := func(tx *badger.Txn) error {
+		for i, x := range indexes {
+			if x < 0 || x >= r.n {
+				return &os.PathError{Op: "read", Path: fmt.Sprintf("hash %d", x), Err: os.ErrNotExist}
+			}
+			data, err := get(tx, indexKey(hashPrefix, x))
+			if err != nil {
+				return fmt.Errorf("reading hash %d: %v", x, err)
+			}
+			if len(data) != tlog.HashSize {
+				return fmt.Errorf("invalid hash %d", x)
+			}
+			copy(list[i][:], data)
+		}
+		return nil
+	}
+	var err error
+	if r.tx != nil {
+		err = read(r.tx)
+	} else {
+		err = r.s.bdb.View(read)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// committedSize returns the size of the log as committed in tx.
+func committedSize(tx *badger.Txn) (int64, error) {
+	data, err := get(tx, []byte(sizeKey))
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid log size %q", data)
+	}
+	return size, nil
+}
+
+// indexKey returns the database key for the record ID or hash index x.
+func indexKey(prefix string, x int64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], uint64(x))
+	return key
+}
+
+// get returns a copy of the value of key in tx.
+func get(tx *badger.Txn, key []byte) ([]byte, error) {
+	item, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
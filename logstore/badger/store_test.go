@@ -0,0 +1,167 @@
+package badger_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/logstore/badger/badgertest"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := badgertest.NewStore(t)
+	verifier, err := note.NewVerifier(s.VerifierKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server holds the same records, in memory.
+	record := func(i int) []byte {
+		return []byte(fmt.Sprintf("example.com/%d\nh1:%d=\n", i, i))
+	}
+	ts := sumdb.NewTestServer(s.SignerKey, func(path, vers string) ([]byte, error) {
+		var i int
+		fmt.Sscan(vers, &i)
+		return record(i), nil
+	})
+
+	for i := 0; i < 300; i++ {
+		id, err := s.Append(ctx, fmt.Sprintf("example.com/%d", i), record(i))
+		if err != nil || id != int64(i) {
+			t.Fatalf("Append(%d) = %d, %v", i, id, err)
+		}
+		if _, err := ts.Lookup(ctx, fmt.Sprintf("x@%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The log survives a restart.
+	s.Reopen(t)
+
+	msg, err := s.Signed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := note.Open(msg, note.VerifierList(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ts.Signed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNote, err := note.Open(want, note.VerifierList(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Text != wantNote.Text {
+		t.Fatalf("Signed tree:\n%s\nwant:\n%s", n.Text, wantNote.Text)
+	}
+
+	id, err := s.Lookup(ctx, "example.com/123")
+	if err != nil || id != 123 {
+		t.Fatalf("Lookup = %d, %v, want 123", id, err)
+	}
+	if _, err := s.Lookup(ctx, "example.com/999"); !os.IsNotExist(err) {
+		t.Fatalf("Lookup of missing key: err = %v, want not exist", err)
+	}
+	records, err := s.ReadRecords(ctx, 250, 50)
+	if err != nil || len(records) != 50 || !bytes.Equal(records[0], record(250)) {
+		t.Fatalf("ReadRecords = %d records, %v", len(records), err)
+	}
+	if _, err := s.ReadRecords(ctx, 250, 51); !os.IsNotExist(err) {
+		t.Fatalf("ReadRecords beyond tree: err = %v, want not exist", err)
+	}
+
+	for _, tile := range []tlog.Tile{
+		{H: 8, L: 0, N: 0, W: 256},
+		{H: 8, L: 0, N: 1, W: 44},
+		{H: 8, L: 1, N: 0, W: 1},
+	} {
+		data, err := s.ReadTileData(ctx, tile)
+		if err != nil {
+			t.Fatalf("ReadTileData(%v): %v", tile.Path(), err)
+		}
+		want, err := ts.ReadTileData(ctx, tile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("ReadTileData(%v) differs from test server", tile.Path())
+		}
+	}
+	if _, err := s.ReadTileData(ctx, tlog.Tile{H: 8, L: 0, N: 1, W: 45}); !os.IsNotExist(err) {
+		t.Fatalf("ReadTileData beyond tree: err = %v, want not exist", err)
+	}
+
+	// A newer record for a key replaces the older one in lookups.
+	id, err = s.Append(ctx, "example.com/123", []byte("example.com/123\nh1:123=\nh1:new=\n"))
+	if err != nil || id != 300 {
+		t.Fatalf("Append = %d, %v, want 300", id, err)
+	}
+	if id, err := s.Lookup(ctx, "example.com/123"); err != nil || id != 300 {
+		t.Fatalf("Lookup after append = %d, %v, want 300", id, err)
+	}
+}
+
+func TestStoreConcurrentLookup(t *testing.T) {
+	ctx := context.Background()
+	s := badgertest.NewStore(t)
+	verifier, err := note.NewVerifier(s.VerifierKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 100
+	errc := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("example.com/%d", i)
+			if _, err := s.Append(ctx, key, []byte(key+"\n")); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- nil
+	}()
+
+	// A record is readable, and in the signed tree,
+	// as soon as Lookup finds its key.
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("example.com/%d", i)
+		id, err := s.Lookup(ctx, key)
+		for os.IsNotExist(err) {
+			id, err = s.Lookup(ctx, key)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.ReadRecords(ctx, id, 1); err != nil {
+			t.Fatalf("ReadRecords(%d) after Lookup: %v", id, err)
+		}
+		msg, err := s.Signed(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tn, err := note.Open(msg, note.VerifierList(verifier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := tlog.ParseTree([]byte(tn.Text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id >= tree.N {
+			t.Fatalf("record %d found by Lookup is not in signed tree %d", id, tree.N)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,395 @@
+// Package mirror maintains a verified local copy of an asset transparency
+// log and serves it with the same HTTP protocol as the log server, so that
+// clients can use the mirror in place of the log.
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// tileHeight is the height of the log's tiles,
+// the same as the sumdb.Client default.
+const tileHeight = 8
+
+// A Mirror is a local copy of a log, stored in a directory using the
+// log server's URL paths: the signed tree head in "latest" and the hash
+// and record data tiles under "tile/". The "index" file maps the key of
+// each record, its first line, to the record's ID.
+//
+// Everything in the directory is authenticated against the signed tree
+// head before it is stored, so a Mirror serves only data that clients
+// will accept.
+type Mirror struct {
+	dir       string
+	verifiers note.Verifiers
+
+	mu      sync.Mutex
+	indexed int64            // number of records in index
+	index   map[string]int64 // record ID by key
+}
+
+// New returns a Mirror stored in dir of the log
+// whose tree heads are signed by any of verifiers.
+func New(dir string, verifiers ...note.Verifier) *Mirror {
+	return &Mirror{
+		dir:       dir,
+		verifiers: note.VerifierList(verifiers...),
+	}
+}
+
+// Latest returns the latest tree head of the mirror
+// along with its encoded signed note.
+// It returns an empty tree if the mirror has not been synced.
+func (m *Mirror) Latest() (tlog.Tree, []byte, error) {
+	msg, err := ioutil.ReadFile(filepath.Join(m.dir, "latest"))
+	if os.IsNotExist(err) {
+		return tlog.Tree{}, nil, nil
+	}
+	if err != nil {
+		return tlog.Tree{}, nil, err
+	}
+	tree, err := m.openTree(msg)
+	if err != nil {
+		return tlog.Tree{}, nil, err
+	}
+	return tree, msg, nil
+}
+
+// openTree verifies the signed tree note msg and returns its tree.
+func (m *Mirror) openTree(msg []byte) (tlog.Tree, error) {
+	n, err := note.Open(msg, m.verifiers)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("reading tree note: %w\nnote:\n%s", err, msg)
+	}
+	tree, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("reading tree: %v\ntree:\n%s", err, n.Text)
+	}
+	return tree, nil
+}
+
+// Sync brings the mirror up to date with the log's latest tree head,
+// downloading the tiles published since the mirror's tree head.
+// It checks that the new tree head is consistent with the mirror's
+// before storing any of its tiles, and authenticates every tile and
+// record against the new tree head. The new tree head is stored last,
+// so an interrupted Sync resumes where it left off.
+// Sync returns the mirror's tree heads before and after the sync.
+func (m *Mirror) Sync(ctx context.Context, remote sumdb.Remote) (old, tree tlog.Tree, err error) {
+	old, _, err = m.Latest()
+	if err != nil {
+		return old, old, err
+	}
+	msg, err := remote.ReadRemoteContext(ctx, "/latest", "")
+	if err != nil {
+		return old, old, err
+	}
+	tree, err = m.openTree(msg)
+	if err != nil {
+		return old, old, err
+	}
+
+	r := &tileReader{m: m, ctx: ctx, remote: remote}
+	if tree.N <= old.N {
+		// Nothing new, but the log must not have forked.
+		if tree.N > 0 {
+			h, err := tlog.TreeHash(tree.N, tlog.TileHashReader(old, r))
+			if err != nil {
+				return old, old, err
+			}
+			if h != tree.Hash {
+				return old, old, fmt.Errorf("%w: log tree %d is inconsistent with mirrored tree %d", sumdb.ErrSecurity, tree.N, old.N)
+			}
+		}
+		return old, old, nil
+	}
+
+	// Check that the new tree extends the mirrored one
+	// before storing any of its tiles.
+	if old.N > 0 {
+		r.hold = make(map[tlog.Tile][]byte)
+		h, err := tlog.TreeHash(old.N, tlog.TileHashReader(tree, r))
+		if err != nil {
+			return old, old, err
+		}
+		if h != old.Hash {
+			return old, old, fmt.Errorf("%w: log tree %d is inconsistent with mirrored tree %d", sumdb.ErrSecurity, tree.N, old.N)
+		}
+		for t, data := range r.hold {
+			if err := m.writeTile(t, data); err != nil {
+				return old, old, err
+			}
+		}
+		r.hold = nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return old, old, err
+	}
+	index, err := os.OpenFile(filepath.Join(m.dir, "index"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return old, old, err
+	}
+	defer index.Close()
+	w := bufio.NewWriter(index)
+
+	thr := tlog.TileHashReader(tree, r)
+	tiles := tlog.NewTiles(tileHeight, old.N, tree.N)
+	for i, t := range tiles {
+		// NewTiles lists every width of the last partial tile
+		// in each level; only the widest is needed.
+		if i+1 < len(tiles) && tiles[i+1].L == t.L && tiles[i+1].N == t.N {
+			continue
+		}
+		// Reading the last hash in t makes thr fetch,
+		// authenticate and save t along with any parents.
+		last := t.N<<uint(t.H) + int64(t.W) - 1
+		if _, err := thr.ReadHashes([]int64{tlog.StoredHashIndex(t.L*t.H, last)}); err != nil {
+			return old, old, err
+		}
+		if r.err != nil {
+			return old, old, r.err
+		}
+		if t.L != 0 {
+			continue
+		}
+
+		// The level 0 hashes are the hashes of the records
+		// in the data tile with the same coordinates.
+		records, err := r.syncData(thr, t)
+		if err != nil {
+			return old, old, err
+		}
+		start := t.N << uint(t.H)
+		for i, text := range records {
+			id := start + int64(i)
+			if id < old.N {
+				continue
+			}
+			fmt.Fprintf(w, "%s %d\n", recordKey(text), id)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return old, old, err
+	}
+	if err := index.Sync(); err != nil {
+		return old, old, err
+	}
+
+	if err := writeFile(filepath.Join(m.dir, "latest"), msg); err != nil {
+		return old, old, err
+	}
+	return old, tree, nil
+}
+
+// syncData fetches the record data tile corresponding to the level 0 hash
+// tile t, authenticates its records against the hashes in t, stores it,
+// and returns the records.
+func (r *tileReader) syncData(thr tlog.HashReader, t tlog.Tile) ([][]byte, error) {
+	dt := t
+	dt.L = -1
+	data, err := sumdb.ReadRemoteTile(r.ctx, r.remote, dt)
+	if err != nil {
+		return nil, err
+	}
+
+	start := t.N << uint(t.H)
+	indexes := make([]int64, t.W)
+	for i := range indexes {
+		indexes[i] = tlog.StoredHashIndex(0, start+int64(i))
+	}
+	hashes, err := thr.ReadHashes(indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	records, n, err := parseRecords(data, start, t.W)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", dt.Path(), err)
+	}
+	for i, text := range records {
+		if tlog.RecordHash(text) != hashes[i] {
+			return nil, fmt.Errorf("reading %s: cannot authenticate record %d", dt.Path(), start+int64(i))
+		}
+	}
+	if err := r.m.writeTile(dt, data[:n]); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// parseRecords parses the first w records from the record data tile data,
+// which must start with record start. It returns the records and the
+// length of their encoding.
+func parseRecords(data []byte, start int64, w int) ([][]byte, int, error) {
+	var records [][]byte
+	rest := data
+	for i := 0; i < w; i++ {
+		id, text, next, err := tlog.ParseRecord(rest)
+		if err != nil {
+			return nil, 0, err
+		}
+		if id != start+int64(i) {
+			return nil, 0, fmt.Errorf("found record %d, want %d", id, start+int64(i))
+		}
+		records = append(records, text)
+		rest = next
+	}
+	return records, len(data) - len(rest), nil
+}
+
+// recordKey returns the key of the record text, its first line.
+func recordKey(text []byte) string {
+	if i := bytes.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return string(text)
+}
+
+// tileFile returns the name of the file holding t.
+func (m *Mirror) tileFile(t tlog.Tile) string {
+	return filepath.Join(m.dir, filepath.FromSlash(t.Path()))
+}
+
+// writeTile stores t. A full tile replaces any partial tile with the
+// same coordinates, and a wider partial tile replaces a narrower one.
+func (m *Mirror) writeTile(t tlog.Tile, data []byte) error {
+	file := m.tileFile(t)
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	if err := writeFile(file, data); err != nil {
+		return err
+	}
+	full := t
+	full.W = 1 << uint(t.H)
+	partials, _ := filepath.Glob(m.tileFile(full) + ".p/*")
+	for _, p := range partials {
+		if p != file {
+			os.Remove(p)
+		}
+	}
+	if t == full {
+		os.Remove(m.tileFile(full) + ".p")
+	}
+	return nil
+}
+
+// readTile returns the data for t from the stored tile
+// with the same coordinates that is at least as wide.
+// The data for a record tile is returned untruncated.
+func (m *Mirror) readTile(t tlog.Tile) ([]byte, error) {
+	full := t
+	full.W = 1 << uint(t.H)
+	files := []string{m.tileFile(t), m.tileFile(full)}
+	partials, _ := filepath.Glob(m.tileFile(full) + ".p/*")
+	files = append(files, partials...)
+	for _, file := range files {
+		w := full.W
+		if i := strings.LastIndex(file, ".p"+string(filepath.Separator)); i >= 0 {
+			w, _ = strconv.Atoi(file[i+3:])
+		}
+		if w < t.W {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if t.L >= 0 {
+			// Skip a damaged file too short to hold the tile.
+			if len(data) < t.W*tlog.HashSize {
+				continue
+			}
+			data = data[:t.W*tlog.HashSize]
+		}
+		return data, nil
+	}
+	return nil, &os.PathError{Op: "read", Path: t.Path(), Err: os.ErrNotExist}
+}
+
+// writeFile writes data to file atomically,
+// creating its directory if necessary.
+func writeFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// tileReader implements tlog.TileReader for Sync,
+// reading tiles from the mirror if stored and otherwise from remote.
+type tileReader struct {
+	m      *Mirror
+	ctx    context.Context
+	remote sumdb.Remote
+
+	// hold, if not nil, holds authenticated tiles instead of storing
+	// them in the mirror, and tiles are read only from remote, so that
+	// the tiles of a forked log are never mixed with the mirror's.
+	hold map[tlog.Tile][]byte
+	err  error // first error storing a tile
+}
+
+func (r *tileReader) Height() int {
+	return tileHeight
+}
+
+func (r *tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, t := range tiles {
+		var d []byte
+		err := os.ErrNotExist
+		if r.hold == nil {
+			d, err = r.m.readTile(t)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			d, err = sumdb.ReadRemoteTile(r.ctx, r.remote, t)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data[i] = d
+	}
+	return data, nil
+}
+
+func (r *tileReader) SaveTiles(tiles []tlog.Tile, data [][]byte) {
+	for i, t := range tiles {
+		if r.hold != nil {
+			r.hold[t] = data[i]
+			continue
+		}
+		if err := r.m.writeTile(t, data[i]); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+}
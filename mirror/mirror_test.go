@@ -0,0 +1,174 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/sumdb"
+	"go.transparencylog.com/tl/sumdb/sumdbtest"
+)
+
+// testLog is a log server with records named by a prefix.
+type testLog struct {
+	t      *testing.T
+	ts     *sumdb.TestServer
+	prefix string
+	n      int
+}
+
+func newTestLog(t *testing.T, skey, prefix string) *testLog {
+	gosum := func(path, vers string) ([]byte, error) {
+		return []byte(fmt.Sprintf("%s@%s\nh1:%s=\n", path, vers, vers)), nil
+	}
+	return &testLog{t: t, ts: sumdb.NewTestServer(skey, gosum), prefix: prefix}
+}
+
+// add adds n records to the log.
+func (l *testLog) add(n int) {
+	for i := 0; i < n; i++ {
+		if _, err := l.ts.Lookup(context.Background(), fmt.Sprintf("example.com/%s@%d", l.prefix, l.n)); err != nil {
+			l.t.Fatal(err)
+		}
+		l.n++
+	}
+}
+
+func (l *testLog) remote() sumdb.Remote {
+	return sumdbtest.NewRemote(sumdb.NewServer(l.ts))
+}
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "tl-mirror-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := newTestLog(t, skey, "a")
+	m := New(dir, verifier)
+	sync := func(want int64) {
+		t.Helper()
+		_, tree, err := m.Sync(ctx, l.remote())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.N != want {
+			t.Fatalf("Sync: tree %d, want %d", tree.N, want)
+		}
+	}
+	exists := func(path string, want bool) {
+		t.Helper()
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if (err == nil) != want {
+			t.Fatalf("%s exists = %v, want %v", path, err == nil, want)
+		}
+	}
+
+	l.add(300)
+	sync(300)
+	exists("tile/8/0/000", true)
+	exists("tile/8/data/000", true)
+	exists("tile/8/0/001.p/44", true)
+	exists("tile/8/data/001.p/44", true)
+	exists("tile/8/1/000.p/1", true)
+
+	// The next sync resumes from tree 300
+	// and replaces the partial tiles.
+	l.add(250)
+	sync(550)
+	exists("tile/8/0/001", true)
+	exists("tile/8/0/001.p/44", false)
+	exists("tile/8/data/001.p/44", false)
+	exists("tile/8/0/002.p/38", true)
+	exists("tile/8/1/000.p/2", true)
+	sync(550)
+
+	// The mirror serves the same data as the log.
+	if _, err := m.Lookup(ctx, "example.com/a@0"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Lookup(ctx, "example.com/a@400")
+	if err != nil || id != 400 {
+		t.Fatalf("Lookup(a@400) = %d, %v, want 400", id, err)
+	}
+	if _, err := m.Lookup(ctx, "example.com/a@999"); !os.IsNotExist(err) {
+		t.Fatalf("Lookup(a@999): err = %v, want not exist", err)
+	}
+	records, err := m.ReadRecords(ctx, 250, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := l.ts.ReadRecords(ctx, 250, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(want) {
+		t.Fatalf("ReadRecords returned %d records, want %d", len(records), len(want))
+	}
+	for i := range records {
+		if !bytes.Equal(records[i], want[i]) {
+			t.Fatalf("record %d = %q, want %q", 250+i, records[i], want[i])
+		}
+	}
+	for _, tile := range []tlog.Tile{
+		{H: 8, L: 0, N: 0, W: 256},
+		{H: 8, L: 0, N: 1, W: 44}, // replaced by the full tile
+		{H: 8, L: 0, N: 2, W: 38},
+		{H: 8, L: 0, N: 2, W: 10},
+		{H: 8, L: 1, N: 0, W: 1},
+	} {
+		data, err := m.ReadTileData(ctx, tile)
+		if err != nil {
+			t.Fatalf("ReadTileData(%v): %v", tile.Path(), err)
+		}
+		want, err := l.ts.ReadTileData(ctx, tile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Fatalf("ReadTileData(%v) differs from log", tile.Path())
+		}
+	}
+	if _, err := m.ReadTileData(ctx, tlog.Tile{H: 8, L: 0, N: 2, W: 39}); !os.IsNotExist(err) {
+		t.Fatalf("ReadTileData beyond tree: err = %v, want not exist", err)
+	}
+
+	// A tile file cut short is not served.
+	short := filepath.Join(dir, "tile", "8", "0", "002.p", "38")
+	if err := ioutil.WriteFile(short, make([]byte, 5*tlog.HashSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ReadTileData(ctx, tlog.Tile{H: 8, L: 0, N: 2, W: 10}); !os.IsNotExist(err) {
+		t.Fatalf("ReadTileData of short file: err = %v, want not exist", err)
+	}
+
+	// A log that forked from the mirrored one is refused.
+	fork := newTestLog(t, skey, "b")
+	fork.add(600)
+	if _, _, err := m.Sync(ctx, fork.remote()); !errors.Is(err, sumdb.ErrSecurity) {
+		t.Fatalf("Sync of forked log: err = %v, want ErrSecurity", err)
+	}
+	exists("tile/8/0/002", false)
+	tree, _, err := m.Latest()
+	if err != nil || tree.N != 550 {
+		t.Fatalf("Latest after forked sync = %d, %v, want 550", tree.N, err)
+	}
+}
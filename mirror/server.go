@@ -0,0 +1,117 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+// The Mirror implements sumdb.ServerOps, so that a sumdb.Server
+// can serve the mirrored log. Another process may Sync the mirror
+// while it is being served.
+
+// Signed returns the mirror's latest signed tree head.
+func (m *Mirror) Signed(ctx context.Context) ([]byte, error) {
+	_, msg, err := m.Latest()
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("mirror has not been synced")
+	}
+	return msg, nil
+}
+
+// ReadRecords returns the content for the n records id through id+n-1.
+func (m *Mirror) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	var list [][]byte
+	for n > 0 {
+		// Read the rest of the records in the data tile holding id.
+		t := tlog.Tile{H: tileHeight, L: -1, N: id >> tileHeight}
+		start := t.N << tileHeight
+		t.W = int(id - start + n)
+		if t.W > 1<<tileHeight {
+			t.W = 1 << tileHeight
+		}
+		data, err := m.readTile(t)
+		if err != nil {
+			return nil, err
+		}
+		records, _, err := parseRecords(data, start, t.W)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", t.Path(), err)
+		}
+		records = records[id-start:]
+		list = append(list, records...)
+		id += int64(len(records))
+		n -= int64(len(records))
+	}
+	return list, nil
+}
+
+// Lookup returns the ID of the latest record for key.
+func (m *Mirror) Lookup(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tree, _, err := m.Latest()
+	if err != nil {
+		return 0, err
+	}
+	if m.index == nil || m.indexed != tree.N {
+		if err := m.loadIndex(tree.N); err != nil {
+			return 0, err
+		}
+	}
+	id, ok := m.index[key]
+	if !ok {
+		return 0, &os.PathError{Op: "lookup", Path: key, Err: os.ErrNotExist}
+	}
+	return id, nil
+}
+
+// loadIndex loads the index of the first n records.
+// Later records are in the index only if a Sync is in progress
+// or was interrupted, and are ignored.
+func (m *Mirror) loadIndex(n int64) error {
+	f, err := os.Open(filepath.Join(m.dir, "index"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	index := make(map[string]int64)
+	if f != nil {
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			line := s.Text()
+			i := strings.LastIndex(line, " ")
+			if i < 0 {
+				continue
+			}
+			id, err := strconv.ParseInt(line[i+1:], 10, 64)
+			if err != nil || id >= n {
+				continue
+			}
+			if old, ok := index[line[:i]]; !ok || id > old {
+				index[line[:i]] = id
+			}
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+	m.index = index
+	m.indexed = n
+	return nil
+}
+
+// ReadTileData reads the content of the hash tile t.
+func (m *Mirror) ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	return m.readTile(t)
+}
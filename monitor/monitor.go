@@ -0,0 +1,203 @@
+// Package monitor watches the signed tree heads published by an asset
+// transparency log over time and raises alerts when the log stops
+// growing, rolls back to an older tree, or forks its history.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// A Kind is a kind of log misbehavior reported by an Alert.
+type Kind string
+
+const (
+	// Stall means the log has not grown for longer than Monitor.StallAfter.
+	Stall Kind = "stall"
+
+	// Rollback means the log published a tree head that is consistent
+	// with, but older than, one it published before.
+	Rollback Kind = "rollback"
+
+	// Fork means the log published a tree head that is inconsistent
+	// with one it published before. This is proof that the log is
+	// misbehaving.
+	Fork Kind = "fork"
+)
+
+// An Alert describes log misbehavior detected by a Monitor.
+type Alert struct {
+	Kind    Kind      `json:"kind"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+
+	// Latest is the latest tree head the monitor had checked
+	// and Note is the signed note of the tree head that raised the alert.
+	// They are the same tree head for a Stall.
+	TreeSize   int64  `json:"tree_size"`
+	TreeHash   string `json:"tree_hash"`
+	LatestSize int64  `json:"latest_size"`
+	LatestHash string `json:"latest_hash"`
+	Note       string `json:"note"`
+
+	// Evidence is the report proving a Fork.
+	Evidence string `json:"evidence,omitempty"`
+}
+
+// A Monitor regularly fetches a log's latest tree head, checks it against
+// the previous ones, and sends an Alert to its Sink for any misbehavior.
+//
+// The Monitor uses a Client for the checks, so the Client's ClientOps
+// persist the latest tree head checked across runs. The ClientOps must
+// pass the reports of their SecurityError method to the Monitor's Report
+// method so that Fork alerts carry the proof of the fork.
+type Monitor struct {
+	Client *sumdb.Client
+	Sink   Sink
+
+	// History, if not nil, receives every distinct signed tree head
+	// the monitor sees, in the format read by tl gossip import.
+	History io.Writer
+
+	// StallAfter is how long the log may go without growing before
+	// the monitor sends a Stall alert. Zero disables the check.
+	StallAfter time.Duration
+
+	grew    time.Time // when the log was last seen growing
+	last    []byte    // last signed note written to History
+	alerted []byte    // signed note of the last Rollback or Fork alert
+	stalled bool      // a Stall alert has been sent for the current tree
+	report  string    // last security error report
+
+	now func() time.Time // for testing; nil means time.Now
+}
+
+// Report records msg, a security error report from the Client's
+// ClientOps, as the evidence for the next Fork alert.
+func (m *Monitor) Report(msg string) {
+	m.report = msg
+}
+
+// Check fetches the log's latest tree head, records it in the history,
+// checks it against the latest tree head checked before, and sends
+// any resulting alert to the sink. It returns an error only if the check
+// could not be done or the alert could not be sent.
+func (m *Monitor) Check(ctx context.Context) error {
+	now := time.Now()
+	if m.now != nil {
+		now = m.now()
+	}
+	latest, latestMsg, err := m.Client.LoadLatest(ctx)
+	if err != nil {
+		return err
+	}
+	if m.grew.IsZero() {
+		m.grew = now
+		m.last = latestMsg
+	}
+
+	msg, err := m.Client.FetchLatest(ctx)
+	if err != nil {
+		return err
+	}
+	tree, err := parseTree(msg)
+	if err != nil {
+		return fmt.Errorf("reading tree note: %v", err)
+	}
+
+	m.report = ""
+	err = m.Client.MergeLatest(ctx, msg)
+	if err != nil && !errors.Is(err, sumdb.ErrSecurity) {
+		return err
+	}
+	if err := m.record(msg); err != nil {
+		return err
+	}
+
+	a := &Alert{
+		Time:       now,
+		TreeSize:   tree.N,
+		TreeHash:   tree.Hash.String(),
+		LatestSize: latest.N,
+		LatestHash: latest.Hash.String(),
+		Note:       string(msg),
+	}
+	switch {
+	case err != nil:
+		a.Kind = Fork
+		a.Message = fmt.Sprintf("tree %d is inconsistent with tree %d", tree.N, latest.N)
+		a.Evidence = m.report
+	case tree.N < latest.N:
+		a.Kind = Rollback
+		a.Message = fmt.Sprintf("log rolled back from tree %d to tree %d", latest.N, tree.N)
+	case tree.N > latest.N:
+		m.grew = now
+		m.stalled = false
+		return nil
+	case m.StallAfter > 0 && now.Sub(m.grew) >= m.StallAfter && !m.stalled:
+		m.stalled = true
+		a.Kind = Stall
+		a.Message = fmt.Sprintf("log has not grown past tree %d since %s", tree.N, m.grew.Format(time.RFC3339))
+		return m.Sink.Alert(ctx, a)
+	default:
+		return nil
+	}
+
+	// A misbehaving log keeps serving the same bad tree head;
+	// alert once for each one.
+	if bytes.Equal(msg, m.alerted) {
+		return nil
+	}
+	m.alerted = msg
+	return m.Sink.Alert(ctx, a)
+}
+
+// record appends msg to the history if it differs from the last one.
+func (m *Monitor) record(msg []byte) error {
+	if m.History == nil || bytes.Equal(msg, m.last) {
+		return nil
+	}
+	if _, err := m.History.Write(msg); err != nil {
+		return fmt.Errorf("writing history: %v", err)
+	}
+	m.last = msg
+	return nil
+}
+
+// Run calls Check every interval until ctx is done,
+// logging any errors.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		cctx, cancel := context.WithTimeout(ctx, interval)
+		err := m.Check(cctx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("monitor: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// parseTree returns the tree in the signed note msg without verifying it.
+func parseTree(msg []byte) (tlog.Tree, error) {
+	i := bytes.Index(msg, []byte("\n\n"))
+	if i < 0 {
+		return tlog.Tree{}, errors.New("malformed note")
+	}
+	return tlog.ParseTree(msg[:i+1])
+}
@@ -0,0 +1,340 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// testOps is a sumdb.ClientOps serving the tree heads and tiles of a
+// TestServer, or a scripted tree head in place of the server's latest.
+// Like the on-disk cache of tl, it keeps the tiles the client saves.
+type testOps struct {
+	t      *testing.T
+	m      *Monitor
+	vkey   string
+	srv    http.Handler
+	latest []byte // served at /latest if not nil
+	config map[string][]byte
+	cache  map[string][]byte
+}
+
+func (o *testOps) ReadRemote(path, query string) ([]byte, error) {
+	if path == "/latest" && o.latest != nil {
+		return o.latest, nil
+	}
+	w := httptest.NewRecorder()
+	o.srv.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		return nil, &sumdb.RemoteError{Path: path, StatusCode: w.Code, Status: http.StatusText(w.Code)}
+	}
+	return w.Body.Bytes(), nil
+}
+
+func (o *testOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.vkey), nil
+	}
+	return o.config[file], nil
+}
+
+func (o *testOps) WriteConfig(file string, old, new []byte) error {
+	if !bytes.Equal(o.config[file], old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.config[file] = new
+	return nil
+}
+
+func (o *testOps) ReadCache(file string) ([]byte, error) {
+	if data, ok := o.cache[file]; ok {
+		return data, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (o *testOps) WriteCache(file string, data []byte) {
+	o.cache[file] = data
+}
+
+func (o *testOps) Log(msg string) {
+	o.t.Log(msg)
+}
+
+func (o *testOps) SecurityError(msg string) {
+	o.m.Report(msg)
+}
+
+// testSink records the alerts sent to it.
+type testSink struct {
+	alerts []*Alert
+}
+
+func (s *testSink) Alert(ctx context.Context, a *Alert) error {
+	s.alerts = append(s.alerts, a)
+	return nil
+}
+
+// testLog is a log for the monitor to watch.
+type testLog struct {
+	t  *testing.T
+	ts *sumdb.TestServer
+	n  int
+}
+
+func newTestLog(t *testing.T, skey, prefix string, n int) *testLog {
+	l := &testLog{t: t}
+	l.ts = sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		return []byte(prefix + path + "@" + vers + "\n"), nil
+	})
+	l.add(n)
+	return l
+}
+
+// add appends n records to the log.
+func (l *testLog) add(n int) {
+	for ; n > 0; n-- {
+		if _, err := l.ts.Lookup(context.Background(), fmt.Sprintf("r@%d", l.n)); err != nil {
+			l.t.Fatal(err)
+		}
+		l.n++
+	}
+}
+
+// signed returns the log's latest signed tree head.
+func (l *testLog) signed() []byte {
+	msg, err := l.ts.Signed(context.Background())
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return msg
+}
+
+type monitorTest struct {
+	t    *testing.T
+	ops  *testOps
+	sink *testSink
+	m    *Monitor
+	now  time.Time
+}
+
+// newMonitor returns a monitor of the log served by ops.
+func newMonitor(t *testing.T, ops *testOps) *monitorTest {
+	mt := &monitorTest{
+		t:    t,
+		ops:  ops,
+		sink: new(testSink),
+		now:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	mt.m = &Monitor{
+		Client:     sumdb.NewClient(ops),
+		Sink:       mt.sink,
+		StallAfter: time.Hour,
+		now:        func() time.Time { return mt.now },
+	}
+	ops.m = mt.m
+	return mt
+}
+
+// check runs a check and returns the alert it sent, if any.
+func (mt *monitorTest) check() *Alert {
+	mt.t.Helper()
+	n := len(mt.sink.alerts)
+	if err := mt.m.Check(context.Background()); err != nil {
+		mt.t.Fatalf("Check: %v", err)
+	}
+	switch len(mt.sink.alerts) - n {
+	case 0:
+		return nil
+	case 1:
+		return mt.sink.alerts[n]
+	}
+	mt.t.Fatalf("Check sent %d alerts", len(mt.sink.alerts)-n)
+	return nil
+}
+
+func (mt *monitorTest) mustAlert(kind Kind, size, latest int64) *Alert {
+	mt.t.Helper()
+	a := mt.check()
+	if a == nil {
+		mt.t.Fatalf("Check sent no alert, want %s", kind)
+	}
+	if a.Kind != kind || a.TreeSize != size || a.LatestSize != latest {
+		mt.t.Fatalf("Check sent %s alert for tree %d after %d, want %s for %d after %d",
+			a.Kind, a.TreeSize, a.LatestSize, kind, size, latest)
+	}
+	return a
+}
+
+func (mt *monitorTest) mustNotAlert() {
+	mt.t.Helper()
+	if a := mt.check(); a != nil {
+		mt.t.Fatalf("Check sent %s alert: %s", a.Kind, a.Message)
+	}
+}
+
+func testKey(t *testing.T) (skey, vkey string) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return skey, vkey
+}
+
+func TestMonitorStall(t *testing.T) {
+	skey, vkey := testKey(t)
+	l := newTestLog(t, skey, "", 3)
+	ops := &testOps{t: t, vkey: vkey, srv: sumdb.NewServer(l.ts), config: map[string][]byte{}, cache: map[string][]byte{}}
+	mt := newMonitor(t, ops)
+
+	mt.mustNotAlert()
+	mt.now = mt.now.Add(59 * time.Minute)
+	mt.mustNotAlert()
+	mt.now = mt.now.Add(time.Minute)
+	a := mt.mustAlert(Stall, 3, 3)
+	if !strings.Contains(a.Message, "2020-01-01T00:00:00Z") {
+		t.Errorf("Stall message %q does not say when the log last grew", a.Message)
+	}
+
+	// One alert per stall.
+	mt.now = mt.now.Add(time.Hour)
+	mt.mustNotAlert()
+
+	// Growing resets the timer.
+	l.add(1)
+	mt.mustNotAlert()
+	mt.now = mt.now.Add(59 * time.Minute)
+	mt.mustNotAlert()
+	mt.now = mt.now.Add(time.Minute)
+	mt.mustAlert(Stall, 4, 4)
+}
+
+func TestMonitorRollback(t *testing.T) {
+	skey, vkey := testKey(t)
+	l := newTestLog(t, skey, "", 3)
+	ops := &testOps{t: t, vkey: vkey, srv: sumdb.NewServer(l.ts), config: map[string][]byte{}, cache: map[string][]byte{}}
+	mt := newMonitor(t, ops)
+
+	old := l.signed()
+	l.add(5)
+	mt.mustNotAlert()
+
+	ops.latest = old
+	mt.mustAlert(Rollback, 3, 8)
+
+	// One alert per tree head.
+	mt.mustNotAlert()
+
+	ops.latest = nil
+	mt.mustNotAlert()
+}
+
+func TestMonitorFork(t *testing.T) {
+	skey, vkey := testKey(t)
+	l := newTestLog(t, skey, "", 3)
+	ops := &testOps{t: t, vkey: vkey, srv: sumdb.NewServer(l.ts), config: map[string][]byte{}, cache: map[string][]byte{}}
+	mt := newMonitor(t, ops)
+	mt.mustNotAlert()
+	l.add(2)
+	mt.mustNotAlert()
+
+	// The same tree size with a different hash.
+	fork := newTestLog(t, skey, "fork ", 5)
+	ops.srv = sumdb.NewServer(fork.ts)
+	a := mt.mustAlert(Fork, 5, 5)
+	if !strings.Contains(a.Evidence, "proof of misbehavior") {
+		t.Errorf("Fork evidence = %q, want proof of misbehavior", a.Evidence)
+	}
+
+	// One alert per tree head.
+	mt.mustNotAlert()
+
+	// A larger tree that does not contain the latest one.
+	fork.add(2)
+	a = mt.mustAlert(Fork, 7, 5)
+	if !strings.Contains(a.Evidence, "proof of misbehavior") {
+		t.Errorf("Fork evidence = %q, want proof of misbehavior", a.Evidence)
+	}
+
+	// The monitor keeps the tree head it had checked.
+	ops.srv = sumdb.NewServer(l.ts)
+	mt.mustNotAlert()
+	if tree, _ := mt.m.Client.Latest(); tree.N != 5 {
+		t.Fatalf("latest tree = %d, want 5", tree.N)
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tl-monitor-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	s := &ExecSink{Path: "/bin/sh", Args: []string{"-c", `{ echo "$TL_ALERT_KIND $TL_ALERT_MESSAGE"; cat; } > "$0"`, out}}
+	a := &Alert{Kind: Stall, Message: "log has not grown", TreeSize: 3}
+	if err := s.Alert(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if lines[0] != "stall log has not grown" {
+		t.Errorf("environment = %q, want %q", lines[0], "stall log has not grown")
+	}
+	var got Alert
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil || got.TreeSize != 3 {
+		t.Errorf("stdin = %q, want alert as JSON", lines[1])
+	}
+
+	s = &ExecSink{Path: "/bin/sh", Args: []string{"-c", "exit 1"}}
+	if err := s.Alert(context.Background(), a); err == nil {
+		t.Error("Alert with failing command succeeded")
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got []Alert
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		got = append(got, a)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := &WebhookSink{URL: srv.URL, Client: srv.Client()}
+	a := &Alert{Kind: Fork, Message: "tree 5 is inconsistent with tree 3", Evidence: "proof"}
+	if err := s.Alert(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Kind != Fork || got[0].Evidence != "proof" {
+		t.Fatalf("webhook received %+v", got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := s.Alert(context.Background(), a); err == nil {
+		t.Error("Alert with failing webhook succeeded")
+	}
+}
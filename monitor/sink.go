@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A Sink delivers alerts.
+type Sink interface {
+	Alert(ctx context.Context, a *Alert) error
+}
+
+// Sinks is a Sink that delivers each alert to all of its sinks.
+type Sinks []Sink
+
+// Alert delivers a to every sink, returning the errors of those that failed.
+func (s Sinks) Alert(ctx context.Context, a *Alert) error {
+	var msgs []string
+	for _, sink := range s {
+		if err := sink.Alert(ctx, a); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// A WriterSink writes alerts to W, as text or, if JSON is set,
+// as one JSON object per line.
+type WriterSink struct {
+	W    io.Writer
+	JSON bool
+}
+
+// Alert writes a to s.W.
+func (s *WriterSink) Alert(ctx context.Context, a *Alert) error {
+	if s.JSON {
+		return json.NewEncoder(s.W).Encode(a)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s: %s\n", a.Time.Format(time.RFC3339), strings.ToUpper(string(a.Kind)), a.Message)
+	if a.Evidence != "" {
+		fmt.Fprintf(&buf, "%s\n", a.Evidence)
+	}
+	_, err := s.W.Write(buf.Bytes())
+	return err
+}
+
+// An ExecSink runs a command for each alert. The alert is passed as
+// a JSON object on the command's standard input, and its kind and
+// message in the TL_ALERT_KIND and TL_ALERT_MESSAGE environment variables.
+type ExecSink struct {
+	Path string
+	Args []string
+}
+
+// Alert runs the command for a and waits for it to finish.
+func (s *ExecSink) Alert(ctx context.Context, a *Alert) error {
+	js, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, s.Path, s.Args...)
+	cmd.Env = append(os.Environ(), "TL_ALERT_KIND="+string(a.Kind), "TL_ALERT_MESSAGE="+a.Message)
+	cmd.Stdin = bytes.NewReader(js)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("alert command %s: %v", s.Path, err)
+	}
+	return nil
+}
+
+// A WebhookSink posts each alert as a JSON object to URL.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client // nil means http.DefaultClient
+}
+
+// Alert posts a to s.URL.
+func (s *WebhookSink) Alert(ctx context.Context, a *Alert) error {
+	js, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("alert webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("alert webhook %s: %v", s.URL, resp.Status)
+	}
+	return nil
+}
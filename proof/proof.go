@@ -0,0 +1,112 @@
+// Package proof implements self-contained bundles proving that the asset
+// transparency log vouches for an asset, which can be checked without
+// network access or a client cache.
+package proof
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// A Bundle holds everything needed to check that a log record
+// vouching for an asset digest is contained in a signed tree head.
+type Bundle struct {
+	URL    string `json:"url"`
+	Key    string `json:"key"`    // lookup key of the record
+	Digest string `json:"digest"` // asset digest the record vouches for
+
+	RecordID   int64            `json:"record_id"`
+	Record     string           `json:"record"`      // record data
+	SignedNote string           `json:"signed_note"` // signed tree head containing the record
+	Proof      tlog.RecordProof `json:"proof"`       // proof of the record in the tree
+	LogKey     string           `json:"log_key"`     // verifier key that signed the tree head
+	Time       time.Time        `json:"time"`        // time the bundle was exported, not signed
+}
+
+// ErrWrongLog is returned by Verify for bundles from a log
+// other than the trusted one.
+var ErrWrongLog = errors.New("bundle is not from the trusted log")
+
+// Read reads a bundle written by Write from r.
+func Read(r io.Reader) (*Bundle, error) {
+	b := new(Bundle)
+	if err := json.NewDecoder(r).Decode(b); err != nil {
+		return nil, fmt.Errorf("reading proof bundle: %v", err)
+	}
+	return b, nil
+}
+
+// Write writes b to w as indented JSON.
+func (b *Bundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(b)
+}
+
+// Tree returns the tree of the bundle's signed note without verifying it.
+func (b *Bundle) Tree() (tlog.Tree, error) {
+	i := strings.Index(b.SignedNote, "\n\n")
+	if i < 0 {
+		return tlog.Tree{}, errors.New("malformed signed note")
+	}
+	return tlog.ParseTree([]byte(b.SignedNote[:i+1]))
+}
+
+// Verify checks that b proves that the log with the trusted keys
+// vouches for the asset with the given digest at b.Key.
+// It uses only the contents of b: the signed tree head must be signed
+// by one of the trusted keys that is valid at time now, the record must
+// be contained in that tree, the record must be for b.Key, and it must
+// vouch for digest as asset.Check requires. Neither the log key recorded
+// in the bundle nor b.Time, which anyone can change, is trusted.
+func (b *Bundle) Verify(trusted []sumdb.TrustedKey, digest string, now time.Time) error {
+	found := false
+	for _, k := range trusted {
+		if strings.TrimSpace(b.LogKey) == k.Key {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: bundle log key %s", ErrWrongLog, b.LogKey)
+	}
+
+	n, k, err := sumdb.SigningKey([]byte(b.SignedNote), trusted)
+	if err != nil {
+		return fmt.Errorf("reading tree note: %w", err)
+	}
+	if k.Key != strings.TrimSpace(b.LogKey) {
+		return fmt.Errorf("bundle log key %s did not sign the tree head", b.LogKey)
+	}
+	if !k.ValidAt(now) {
+		return fmt.Errorf("%w: log key %s is not valid at %v", ErrWrongLog, k.Key, now.Format(time.RFC3339))
+	}
+
+	tree, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return err
+	}
+
+	data := []byte(b.Record)
+	if err := tlog.CheckRecord(b.Proof, tree.N, tree.Hash, b.RecordID, tlog.RecordHash(data)); err != nil {
+		return fmt.Errorf("checking record %d in tree#%d: %v", b.RecordID, tree.N, err)
+	}
+
+	// The proof covers the record data but not the key it was looked up
+	// by, so the record must name the key itself.
+	if key := strings.SplitN(b.Record, "\n", 2)[0]; key != b.Key {
+		return fmt.Errorf("record %d is for %q, not %s", b.RecordID, key, b.Key)
+	}
+
+	if digest != b.Digest {
+		return fmt.Errorf("%w: file digest %s != bundle digest %s", asset.ErrMismatch, digest, b.Digest)
+	}
+	return asset.Check(data, digest)
+}
@@ -0,0 +1,202 @@
+package proof
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+	"go.transparencylog.com/tl/asset"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// testLog is an in-memory log for building bundles.
+type testLog struct {
+	t       *testing.T
+	hashes  []tlog.Hash
+	records []string
+	signer  note.Signer
+	vkey    string
+}
+
+func newTestLog(t *testing.T) *testLog {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testLog{t: t, signer: signer, vkey: vkey}
+}
+
+func (l *testLog) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	var list []tlog.Hash
+	for _, id := range indexes {
+		list = append(list, l.hashes[id])
+	}
+	return list, nil
+}
+
+func (l *testLog) add(data string) int64 {
+	id := int64(len(l.records))
+	hashes, err := tlog.StoredHashes(id, []byte(data), l)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	l.hashes = append(l.hashes, hashes...)
+	l.records = append(l.records, data)
+	return id
+}
+
+// bundle returns a bundle for record id in the current tree.
+func (l *testLog) bundle(key, digest string, id int64) *Bundle {
+	n := int64(len(l.records))
+	th, err := tlog.TreeHash(n, l)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	msg, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: n, Hash: th}))}, l.signer)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	p, err := tlog.ProveRecord(n, id, l)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return &Bundle{
+		URL:        "https://" + key,
+		Key:        key,
+		Digest:     digest,
+		RecordID:   id,
+		Record:     l.records[id],
+		SignedNote: string(msg),
+		Proof:      p,
+		LogKey:     l.vkey,
+		Time:       time.Now(),
+	}
+}
+
+// trust returns a trust set holding just the key vkey.
+func trust(vkey string) []sumdb.TrustedKey {
+	return []sumdb.TrustedKey{{Key: vkey}}
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return asset.Digest(sum[:])
+}
+
+func TestBundle(t *testing.T) {
+	l := newTestLog(t)
+	hello := digest("hello\n")
+	l.add("example.com/a.txt\n" + digest("a\n") + "\n")
+	id := l.add("example.com/hello.txt\n" + hello + "\n")
+	l.add("example.com/b.txt\n" + digest("b\n") + "\n")
+
+	b := l.bundle("example.com/hello.txt", hello, id)
+
+	// Round trip through Write and Read.
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Verify(trust(l.vkey), hello, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Verify(trust(l.vkey), digest("other\n"), time.Now()); !errors.Is(err, asset.ErrMismatch) {
+		t.Fatalf("Verify with other digest: err = %v, want ErrMismatch", err)
+	}
+
+	// A bundle from another log is not trusted, even if it names its key.
+	other := newTestLog(t)
+	if err := b.Verify(trust(other.vkey), hello, time.Now()); !errors.Is(err, ErrWrongLog) {
+		t.Fatalf("Verify with other log key: err = %v, want ErrWrongLog", err)
+	}
+	b.LogKey = other.vkey
+	if err := b.Verify(trust(other.vkey), hello, time.Now()); err == nil {
+		t.Fatal("Verify accepted a tree head not signed by the trusted log")
+	}
+	b.LogKey = l.vkey
+
+	// Tampering with the record or the key is detected.
+	tampered := *b
+	tampered.Record = "example.com/hello.txt\n" + digest("evil\n") + "\n"
+	tampered.Digest = digest("evil\n")
+	if err := tampered.Verify(trust(l.vkey), digest("evil\n"), time.Now()); err == nil {
+		t.Fatal("Verify accepted a tampered record")
+	}
+	tampered = *b
+	tampered.Key = "example.com/a.txt"
+	if err := tampered.Verify(trust(l.vkey), hello, time.Now()); err == nil {
+		t.Fatal("Verify accepted a record for another key")
+	}
+	tampered = *b
+	tampered.RecordID = 0
+	if err := tampered.Verify(trust(l.vkey), hello, time.Now()); err == nil {
+		t.Fatal("Verify accepted a proof for another record")
+	}
+}
+
+func TestBundleRotation(t *testing.T) {
+	l := newTestLog(t)
+	oldKey := l.vkey
+	hello := digest("hello\n")
+	id := l.add("example.com/hello.txt\n" + hello + "\n")
+	rotated := time.Now().Add(-time.Hour)
+	old := l.bundle("example.com/hello.txt", hello, id)
+	old.Time = rotated.Add(-time.Minute)
+
+	// The log rotates to a second key with the same name.
+	skey, vkey, err := note.GenerateKey(rand.Reader, "log.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.signer, err = note.NewSigner(skey); err != nil {
+		t.Fatal(err)
+	}
+	l.vkey = vkey
+	trusted := []sumdb.TrustedKey{
+		{Key: oldKey, NotAfter: rotated},
+		{Key: vkey, NotBefore: rotated},
+	}
+
+	now := time.Now()
+	b := l.bundle("example.com/hello.txt", hello, id)
+	if err := b.Verify(trusted, hello, now); err != nil {
+		t.Fatalf("Verify of bundle signed by second key: %v", err)
+	}
+	if b.LogKey != vkey {
+		t.Fatalf("bundle log key = %s, want %s", b.LogKey, vkey)
+	}
+
+	// A bundle signed by the new key is not accepted before it is valid.
+	if err := b.Verify(trusted, hello, rotated.Add(-time.Minute)); !errors.Is(err, ErrWrongLog) {
+		t.Fatalf("Verify before rotation: err = %v, want ErrWrongLog", err)
+	}
+
+	// A bundle signed by the retired key is accepted only while that key
+	// is valid, even if the bundle claims to predate the rotation.
+	if err := old.Verify(trusted, hello, rotated.Add(-time.Minute)); err != nil {
+		t.Fatalf("Verify of bundle signed by retired key before retirement: %v", err)
+	}
+	if err := old.Verify(trusted, hello, now); !errors.Is(err, ErrWrongLog) {
+		t.Fatalf("Verify of backdated bundle signed by retired key: err = %v, want ErrWrongLog", err)
+	}
+
+	// The bundle's log key must be the key that signed it.
+	b.LogKey = oldKey
+	if err := b.Verify(trusted, hello, now); err == nil {
+		t.Fatal("Verify accepted a bundle whose log key did not sign it")
+	}
+}
@@ -0,0 +1,188 @@
+// Package sequencer adds records to a log in batches,
+// signing one tree head per batch instead of one per record.
+package sequencer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// A Log is a log that records can be appended to in batches.
+// It is implemented by logstore/badger.Store.
+type Log interface {
+	sumdb.ServerOps
+
+	// AppendBatch adds records holding data[i] to the log, as the latest
+	// records for keys[i], signs the new tree head and returns the ID of
+	// the first record.
+	AppendBatch(ctx context.Context, keys []string, data [][]byte) (int64, error)
+}
+
+// A Sequencer queues the records appended to it and adds them to its Log
+// in batches. It integrates the queued records every interval, or as soon
+// as a full batch is queued, so a record is in the log's signed tree head
+// at most one interval after it is appended, unless the Log fails.
+//
+// A Sequencer serves the Log's records and tree head, which the Log
+// signs once per batch. A Lookup of a key whose record is still queued
+// returns a *sumdb.PendingError saying when to look again.
+// It implements ingest.Store.
+//
+// A Sequencer queues at most maxQueuedBatches full batches, so that
+// a slow or failing Log cannot make it hold records without bound.
+type Sequencer struct {
+	Log
+
+	interval  time.Duration
+	batchSize int
+
+	mu      sync.Mutex
+	keys    []string       // queued keys, in order
+	data    [][]byte       // queued records, in order
+	pending map[string]int // number of queued records, by key
+	next    time.Time      // time of the next integration
+
+	kick chan struct{} // a full batch is queued
+	quit chan struct{}
+	done chan struct{}
+}
+
+// maxQueuedBatches is the number of full batches
+// a Sequencer queues before it refuses records.
+const maxQueuedBatches = 16
+
+// New returns a Sequencer adding records to l every interval,
+// at most batchSize at a time. Close stops it.
+func New(l Log, interval time.Duration, batchSize int) *Sequencer {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 256
+	}
+	s := &Sequencer{
+		Log:       l,
+		interval:  interval,
+		batchSize: batchSize,
+		pending:   make(map[string]int),
+		next:      time.Now().Add(interval),
+		kick:      make(chan struct{}, 1),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close integrates the queued records and stops the Sequencer.
+// It does not close the Log.
+func (s *Sequencer) Close() error {
+	close(s.quit)
+	<-s.done
+	return s.integrate()
+}
+
+// Append queues a record holding data as the latest record for key.
+// The record gets its ID once it is integrated, so Append returns
+// a *sumdb.PendingError on success. If the queue is full, Append
+// returns an error matching sumdb.ErrRateLimited.
+func (s *Sequencer) Append(ctx context.Context, key string, data []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.keys) >= s.batchSize*maxQueuedBatches {
+		return 0, fmt.Errorf("%w: %d records queued for the log", sumdb.ErrRateLimited, len(s.keys))
+	}
+	s.keys = append(s.keys, key)
+	s.data = append(s.data, data)
+	s.pending[key]++
+	if len(s.keys) >= s.batchSize {
+		select {
+		case s.kick <- struct{}{}:
+		default:
+		}
+	}
+	return 0, s.pendingError(key)
+}
+
+// Lookup returns the ID of the latest record for key,
+// or a *sumdb.PendingError if a record for key is queued.
+func (s *Sequencer) Lookup(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	if s.pending[key] > 0 {
+		defer s.mu.Unlock()
+		return 0, s.pendingError(key)
+	}
+	s.mu.Unlock()
+	return s.Log.Lookup(ctx, key)
+}
+
+// pendingError returns the error for a lookup of the queued key.
+// s.mu must be held.
+func (s *Sequencer) pendingError(key string) error {
+	d := time.Until(s.next)
+	if d < 0 {
+		d = 0
+	}
+	return &sumdb.PendingError{Key: key, RetryAfter: d}
+}
+
+// run integrates the queued records every interval
+// and whenever a full batch is queued.
+func (s *Sequencer) run() {
+	defer close(s.done)
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-t.C:
+		case <-s.kick:
+		}
+		s.mu.Lock()
+		s.next = time.Now().Add(s.interval)
+		s.mu.Unlock()
+		if err := s.integrate(); err != nil {
+			log.Printf("sequencer: %v", err)
+		}
+	}
+}
+
+// integrate adds the queued records to the log, a batch at a time.
+// If the log fails, the records stay queued for the next attempt.
+func (s *Sequencer) integrate() error {
+	for {
+		s.mu.Lock()
+		n := len(s.keys)
+		if n > s.batchSize {
+			n = s.batchSize
+		}
+		keys := s.keys[:n:n]
+		data := s.data[:n:n]
+		s.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		if _, err := s.Log.AppendBatch(context.Background(), keys, data); err != nil {
+			return err
+		}
+
+		// Only now that the records are in the log
+		// can lookups stop reporting them as pending.
+		s.mu.Lock()
+		s.keys = s.keys[n:]
+		s.data = s.data[n:]
+		for _, key := range keys {
+			if s.pending[key]--; s.pending[key] == 0 {
+				delete(s.pending, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
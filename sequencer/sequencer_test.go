@@ -0,0 +1,132 @@
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.transparencylog.com/tl/logstore/badger/badgertest"
+	"go.transparencylog.com/tl/sumdb"
+)
+
+func record(i int) []byte {
+	return []byte(fmt.Sprintf("example.com/%d\nh1:%d=\n", i, i))
+}
+
+func TestSequencer(t *testing.T) {
+	ctx := context.Background()
+	store := badgertest.NewStore(t)
+
+	// The interval is long enough that the tests below
+	// integrate records only by filling a batch or closing.
+	const interval = time.Hour
+	s := New(store, interval, 4)
+
+	// Records wait for the next interval.
+	for i := 0; i < 3; i++ {
+		_, err := s.Append(ctx, fmt.Sprintf("example.com/%d", i), record(i))
+		var pe *sumdb.PendingError
+		if !errors.As(err, &pe) || pe.RetryAfter > interval {
+			t.Fatalf("Append = %v, want pending for at most %v", err, interval)
+		}
+	}
+	if _, err := s.Lookup(ctx, "example.com/1"); !errors.Is(err, sumdb.ErrPending) {
+		t.Fatalf("Lookup of queued record: err = %v, want pending", err)
+	}
+	if _, err := s.Lookup(ctx, "example.com/9"); !os.IsNotExist(err) {
+		t.Fatalf("Lookup of missing record: err = %v, want not exist", err)
+	}
+	if store.Size() != 0 {
+		t.Fatalf("log has %d records before the interval, want 0", store.Size())
+	}
+
+	// Close integrates the queued records.
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.Lookup(ctx, "example.com/1"); err != nil || id != 1 {
+		t.Fatalf("Lookup = %d, %v, want 1", id, err)
+	}
+
+	// A full batch is integrated at once.
+	s = New(store, interval, 4)
+	for i := 3; i < 7; i++ {
+		s.Append(ctx, fmt.Sprintf("example.com/%d", i), record(i))
+	}
+	for store.Size() < 7 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s.Append(ctx, "example.com/7", record(7))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := store.Lookup(ctx, "example.com/7"); err != nil || id != 7 {
+		t.Fatalf("Lookup after Close = %d, %v, want 7", id, err)
+	}
+}
+
+// testLog is a Log that records the batches appended to it.
+// Until gate is closed, AppendBatch waits for it.
+type testLog struct {
+	sumdb.ServerOps // not used
+
+	gate chan struct{}
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (l *testLog) AppendBatch(ctx context.Context, keys []string, data [][]byte) (int64, error) {
+	<-l.gate
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var id int64
+	for _, b := range l.batches {
+		id += int64(len(b))
+	}
+	l.batches = append(l.batches, keys)
+	return id, nil
+}
+
+func TestSequencerQueue(t *testing.T) {
+	ctx := context.Background()
+	l := &testLog{gate: make(chan struct{})}
+	s := New(l, time.Hour, 4)
+
+	// While the log is stuck, records queue up to a limit.
+	max := 4 * maxQueuedBatches
+	var keys []string
+	for i := 0; i < max; i++ {
+		key := fmt.Sprintf("example.com/%d", i)
+		keys = append(keys, key)
+		if _, err := s.Append(ctx, key, record(i)); !errors.Is(err, sumdb.ErrPending) {
+			t.Fatalf("Append %d: err = %v, want pending", i, err)
+		}
+	}
+	if _, err := s.Append(ctx, "example.com/x", record(max)); !errors.Is(err, sumdb.ErrRateLimited) {
+		t.Fatalf("Append to full queue: err = %v, want rate limited", err)
+	}
+
+	// Once the log recovers, the records are integrated
+	// in order and in full batches.
+	close(l.gate)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i, b := range l.batches {
+		if len(b) != 4 {
+			t.Fatalf("batch %d has %d records, want 4", i, len(b))
+		}
+		got = append(got, b...)
+	}
+	if !reflect.DeepEqual(got, keys) {
+		t.Fatalf("integrated %q, want %q", got, keys)
+	}
+}
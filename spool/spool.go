@@ -0,0 +1,122 @@
+// Package spool implements a write buffer that keeps small contents in
+// memory and spills larger contents to a private temporary file, so that
+// content can be hashed and verified before any of it is used.
+package spool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ErrTooLarge is returned by Write when the spooled content
+// would exceed the Buffer's maximum size.
+var ErrTooLarge = errors.New("spool: content exceeds maximum size")
+
+// A Buffer holds content written to it in memory until the content grows
+// past a threshold, after which all of it is moved to a temporary file
+// readable only by the current user.
+// The temporary file is removed by Close.
+// The methods are safe for concurrent use, so that cleanup run when
+// a context is canceled can Close the Buffer, removing the temporary
+// file, while another goroutine is still writing to it.
+type Buffer struct {
+	threshold int64
+	max       int64
+
+	mu   sync.Mutex
+	mem  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+// New returns a Buffer that keeps up to threshold bytes in memory.
+// If max is greater than zero, writes beyond max bytes fail with ErrTooLarge.
+func New(threshold, max int64) *Buffer {
+	return &Buffer{threshold: threshold, max: max}
+}
+
+// Write appends p to the buffer, spilling to a temporary file if necessary.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 && b.size+int64(len(p)) > b.max {
+		return 0, ErrTooLarge
+	}
+	if b.file == nil && b.size+int64(len(p)) > b.threshold {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	var err error
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.mem.Write(p)
+	}
+	b.size += int64(n)
+	return n, err
+}
+
+// spill moves the in-memory content to a new temporary file.
+func (b *Buffer) spill() error {
+	f, err := ioutil.TempFile("", "tl-spool-")
+	if err != nil {
+		return err
+	}
+	if _, err := b.mem.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	b.file = f
+	return nil
+}
+
+// Size returns the number of bytes written to the buffer.
+func (b *Buffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size
+}
+
+// WriteTo writes the full content of the buffer to w.
+func (b *Buffer) WriteTo(w io.Writer) (int64, error) {
+	// Do not hold b.mu while copying, so that a concurrent Close
+	// can interrupt a long copy.
+	b.mu.Lock()
+	f := b.file
+	mem := b.mem.Bytes()
+	b.mu.Unlock()
+
+	if f == nil {
+		return io.Copy(w, bytes.NewReader(mem))
+	}
+	return io.Copy(w, io.NewSectionReader(f, 0, b.Size()))
+}
+
+// Close releases the buffer and removes its temporary file, if any.
+// It is safe to call Close more than once.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.mem.Reset()
+	if b.file == nil {
+		return nil
+	}
+	f := b.file
+	b.file = nil
+	err := f.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
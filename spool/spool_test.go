@@ -0,0 +1,78 @@
+package spool
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBufferMemory(t *testing.T) {
+	b := New(16, 0)
+	defer b.Close()
+
+	b.Write([]byte("hello, "))
+	b.Write([]byte("world"))
+	if b.file != nil {
+		t.Fatalf("spilled %d bytes below threshold", b.Size())
+	}
+
+	var out bytes.Buffer
+	if _, err := b.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello, world" {
+		t.Fatalf("WriteTo = %q, want %q", out.String(), "hello, world")
+	}
+}
+
+func TestBufferSpill(t *testing.T) {
+	b := New(4, 0)
+
+	b.Write([]byte("abc"))
+	b.Write([]byte("defgh"))
+	if b.file == nil {
+		t.Fatal("did not spill above threshold")
+	}
+	name := b.file.Name()
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("spool file mode %v, want private", perm)
+	}
+
+	// WriteTo can be repeated.
+	for i := 0; i < 2; i++ {
+		var out bytes.Buffer
+		if _, err := b.WriteTo(&out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "abcdefgh" {
+			t.Fatalf("WriteTo = %q, want %q", out.String(), "abcdefgh")
+		}
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("spool file not removed by Close: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestBufferMax(t *testing.T) {
+	b := New(4, 10)
+	defer b.Close()
+
+	if _, err := b.Write([]byte(strings.Repeat("x", 8))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Write([]byte("xyz")); err != ErrTooLarge {
+		t.Fatalf("Write past max: err = %v, want ErrTooLarge", err)
+	}
+}
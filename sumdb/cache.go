@@ -57,3 +57,9 @@ func (c *parCache) Get(key interface{}) interface{} {
 	}
 	return e.result
 }
+
+// Delete removes the result associated with key,
+// so that the next call to Do for key calls its function again.
+func (c *parCache) Delete(key interface{}) {
+	c.m.Delete(key)
+}
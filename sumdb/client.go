@@ -6,12 +6,15 @@ package sumdb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.transparencylog.com/mod/sumdb/note"
 	"go.transparencylog.com/mod/sumdb/tlog"
@@ -32,7 +35,8 @@ type ClientOps interface {
 	// ReadConfig reads and returns the content of the named configuration file.
 	// There are only a fixed set of configuration files.
 	//
-	// "key" returns a file containing the verifier key for the server.
+	// "key" returns a file containing the verifier key for the server,
+	// or several keys with validity windows, as parsed by ParseTrust.
 	//
 	// serverName + "/latest" returns a file containing the latest known
 	// signed tree from the server.
@@ -62,18 +66,116 @@ type ClientOps interface {
 	Log(msg string)
 
 	// SecurityError prints the given security error log message.
-	// The Client returns ErrSecurity from any operation that invokes SecurityError,
-	// but the return value is mainly for testing. In a real program,
-	// SecurityError should typically print the message and call log.Fatal or os.Exit.
+	// The Client returns an error wrapping ErrSecurity from any operation
+	// that invokes SecurityError, so a program may either exit here
+	// or let the error reach the caller and exit there.
 	SecurityError(msg string)
 }
 
+// A ContextClientOps is a ClientOps that can also read from the remote
+// database server with a context. If the ClientOps passed to NewClient
+// implements ContextClientOps, the Client uses ReadRemoteContext instead
+// of ReadRemote, so that lookups stop waiting on the server when their
+// context is canceled.
+type ContextClientOps interface {
+	ClientOps
+
+	// ReadRemoteContext is like ReadRemote but
+	// abandons the request when ctx is done.
+	ReadRemoteContext(ctx context.Context, path string, query string) ([]byte, error)
+}
+
 // ErrWriteConflict signals a write conflict during Client.WriteConfig.
 var ErrWriteConflict = errors.New("write conflict")
 
 // ErrSecurity is returned by Client operations that invoke Client.SecurityError.
 var ErrSecurity = errors.New("security error: misbehaving server")
 
+// ErrOffline is returned by offline lookups when the record
+// or a tile needed to authenticate it is not in the local cache.
+var ErrOffline = errors.New("not available offline")
+
+// ErrNotWitnessed is returned when a tree head from the server lacks
+// the witness cosignatures required by SetWitnesses and is not contained
+// in tree heads cosigned by enough of the witnesses.
+var ErrNotWitnessed = errors.New("tree head lacks required witness cosignatures")
+
+// ErrNotFound is matched by errors for lookups of keys
+// that have no record in the database.
+var ErrNotFound = errors.New("not found in database")
+
+// ErrRefused is matched by errors for lookups the server refused
+// to serve by policy, such as a lookup of a URL on a denied host.
+// A Server reports it as 403 Forbidden.
+var ErrRefused = errors.New("refused by server policy")
+
+// ErrRateLimited is matched by errors for lookups the server refused
+// because the client or the URL's host made too many recently.
+// A Server reports it as 429 Too Many Requests.
+var ErrRateLimited = errors.New("rate limited by server")
+
+// ErrPending is matched by errors for lookups of records the server
+// has accepted but not yet added to its tree. A Server reports it as
+// 503 Service Unavailable with a Retry-After header, and the Client
+// retries such lookups after the time the server asks for.
+var ErrPending = errors.New("pending in the log")
+
+// A PendingError is returned by ServerOps.Lookup implementations
+// for a key whose record is waiting to be added to the tree.
+// It matches ErrPending.
+type PendingError struct {
+	Key        string
+	RetryAfter time.Duration // time until the record is expected in the tree
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("%s: %v, retry after %v", e.Key, ErrPending, e.RetryAfter)
+}
+
+func (e *PendingError) Is(target error) bool {
+	return target == ErrPending
+}
+
+// A RemoteError is returned by ClientOps.ReadRemote implementations
+// for a non-200 HTTP response.
+type RemoteError struct {
+	Path       string // path requested from the server
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("http get %s: %v", e.Path, e.Status)
+}
+
+// Is reports whether the error is a missing record, a lookup refused
+// by the server's policy or rate limits, or a pending record, so that
+// errors.Is(err, ErrNotFound), errors.Is(err, ErrRefused),
+// errors.Is(err, ErrRateLimited) and errors.Is(err, ErrPending)
+// can identify such lookups.
+func (e *RemoteError) Is(target error) bool {
+	if !strings.HasPrefix(e.Path, "/lookup/") {
+		return false
+	}
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+	case ErrRefused:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrPending:
+		return e.StatusCode == http.StatusServiceUnavailable && e.RetryAfter > 0
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *RemoteError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
 // A Client is a client connection to a checksum database.
 // All the methods are safe for simultaneous use by multiple goroutines.
 type Client struct {
@@ -82,14 +184,22 @@ type Client struct {
 	didLookup uint32
 
 	// one-time initialized data
-	initOnce   sync.Once
+	initMu     sync.Mutex
+	initDone   bool           // initialization has completed
 	initErr    error          // init error, if any
 	name       string         // name of accepted verifier
-	verifiers  note.Verifiers // accepted verifiers (just one, but Verifiers for note.Open)
-	tileReader tileReader
+	logKeys    []logKey       // the log's own keys, from the "key" configuration
+	verifiers  note.Verifiers // accepted verifiers (the log and its witnesses, for note.Open)
 	tileHeight int
 	nosumdb    string
 
+	witnessKeys      []string        // witness verifier keys, set by SetWitnesses
+	witnessThreshold int             // number of witness cosignatures required
+	witnesses        []note.Verifier // parsed witnessKeys
+	witnessRemotes   []Remote        // where to read cosigned tree heads, set by SetWitnessRemotes
+
+	proofMode bool // check records and trees with the proof endpoints, set by SetProofMode
+
 	record    parCache // cache of record lookup, keyed by path@vers
 	tileCache parCache // cache of c.readTile, keyed by tile
 
@@ -97,8 +207,18 @@ type Client struct {
 	latest    tlog.Tree // latest known tree head
 	latestMsg []byte    // encoded signed note for latest
 
+	witnessedMsg []byte // last tree note from the server that passed checkWitnesses, protected by latestMu
+
 	tileSavedMu sync.Mutex
 	tileSaved   map[tlog.Tile]bool // which tiles have been saved using c.ops.WriteCache already
+
+	now func() time.Time // clock for the validity of log keys; nil means time.Now
+}
+
+// A logKey is a trusted key of the log and its verifier.
+type logKey struct {
+	TrustedKey
+	verifier note.Verifier
 }
 
 // NewClient returns a new Client using the given Client.
@@ -110,20 +230,30 @@ func NewClient(ops ClientOps) *Client {
 
 // init initiailzes the client (if not already initialized)
 // and returns any initialization error.
-func (c *Client) init() error {
-	c.initOnce.Do(c.initWork)
+// Any tiles needed to check the stored latest tree are read using r.
+// An initialization that failed only because r is offline and a tile
+// was not cached, or because the context of r was done, is retried
+// by the next call.
+func (c *Client) init(r *tileReader) error {
+	c.initMu.Lock()
+	defer c.initMu.Unlock()
+
+	if !c.initDone {
+		c.initErr = nil
+		c.initWork(r)
+		c.initDone = !errors.Is(c.initErr, ErrOffline) && !isContextErr(c.initErr)
+	}
 	return c.initErr
 }
 
 // initWork does the actual initialization work.
-func (c *Client) initWork() {
+func (c *Client) initWork(r *tileReader) {
 	defer func() {
 		if c.initErr != nil {
-			c.initErr = fmt.Errorf("initializing sumdb.Client: %v", c.initErr)
+			c.initErr = fmt.Errorf("initializing sumdb.Client: %w", c.initErr)
 		}
 	}()
 
-	c.tileReader.c = c
 	if c.tileHeight == 0 {
 		c.tileHeight = 8
 	}
@@ -134,20 +264,49 @@ func (c *Client) initWork() {
 		c.initErr = err
 		return
 	}
-	verifier, err := note.NewVerifier(strings.TrimSpace(string(vkey)))
+	trusted, err := ParseTrust(vkey)
 	if err != nil {
 		c.initErr = err
 		return
 	}
-	c.verifiers = note.VerifierList(verifier)
-	c.name = verifier.Name()
+	c.logKeys = nil
+	var list []note.Verifier
+	for _, k := range trusted {
+		verifier, err := note.NewVerifier(k.Key)
+		if err != nil {
+			c.initErr = err
+			return
+		}
+		c.logKeys = append(c.logKeys, logKey{k, verifier})
+		list = append(list, verifier)
+	}
+	c.name = c.logKeys[0].verifier.Name()
+
+	c.witnesses = nil
+	for _, key := range c.witnessKeys {
+		w, err := note.NewVerifier(key)
+		if err != nil {
+			c.initErr = fmt.Errorf("witness key: %v", err)
+			return
+		}
+		if w.Name() == c.name {
+			c.initErr = fmt.Errorf("witness key %s has the same name as the log key", w.Name())
+			return
+		}
+		c.witnesses = append(c.witnesses, w)
+	}
+	if c.witnessThreshold > len(c.witnesses) {
+		c.initErr = fmt.Errorf("witness threshold %d exceeds the %d witness keys", c.witnessThreshold, len(c.witnesses))
+		return
+	}
+	c.verifiers = note.VerifierList(append(list, c.witnesses...)...)
 
 	data, err := c.ops.ReadConfig(c.name + "/latest")
 	if err != nil {
 		c.initErr = err
 		return
 	}
-	if err := c.mergeLatest(data); err != nil {
+	if err := c.mergeLatest(r, data, true); err != nil {
 		c.initErr = err
 		return
 	}
@@ -171,26 +330,110 @@ func (c *Client) SetTileHeight(height int) {
 	c.tileHeight = height
 }
 
+// SetWitnesses sets the witnesses whose cosignatures are required
+// on tree heads from the server. Each tree head must then be signed
+// by the server's key and by at least threshold of the witnesses,
+// whose verifier keys are given in vkeys.
+//
+// SetWitnesses must be called, if at all, before any lookups.
+func (c *Client) SetWitnesses(threshold int, vkeys []string) {
+	if atomic.LoadUint32(&c.didLookup) != 0 {
+		panic("SetWitnesses used after Lookup")
+	}
+	if threshold < 0 {
+		panic("invalid call to SetWitnesses")
+	}
+	c.witnessThreshold = threshold
+	c.witnessKeys = vkeys
+}
+
+// SetWitnessRemotes sets where the Client reads the witnesses' own
+// cosigned tree heads: the /latest of each remote, such as a server
+// run by Witness. A tree head from the server that lacks the cosignatures
+// required by SetWitnesses is still accepted if enough of the witnesses
+// have cosigned tree heads that contain it. A cosigned tree head that
+// is inconsistent with the server's is reported with SecurityError.
+//
+// SetWitnessRemotes must be called, if at all, before any lookups.
+func (c *Client) SetWitnessRemotes(remotes []Remote) {
+	if atomic.LoadUint32(&c.didLookup) != 0 {
+		panic("SetWitnessRemotes used after Lookup")
+	}
+	c.witnessRemotes = remotes
+}
+
+// SetProofMode makes the Client check records and the consistency of
+// tree heads using the server's proof endpoints instead of reading tiles,
+// so that each check takes a single small request. Offline lookups still
+// use cached tiles. A server whose consistency proof does not verify is
+// reported with SecurityError, but unlike an inconsistency found in tiles,
+// without evidence that proves the misbehavior to others.
+//
+// SetProofMode must be called, if at all, before any lookups.
+func (c *Client) SetProofMode() {
+	if atomic.LoadUint32(&c.didLookup) != 0 {
+		panic("SetProofMode used after Lookup")
+	}
+	c.proofMode = true
+}
+
 // Lookup returns the record for the given key.
 func (c *Client) Lookup(key string) (id int64, data []byte, err error) {
 	return c.LookupOpts(key, LookupOpts{})
 }
 
+// LookupOpts are options for LookupOpts.
 type LookupOpts struct {
+	// Digest is sent to the server as a hint of the content
+	// the client expects the record to describe.
 	Digest string
+
+	// Offline restricts the lookup to the local cache.
+	// The record and every tile needed to authenticate it
+	// against the cached latest tree must already be cached,
+	// or the lookup fails with ErrOffline.
+	Offline bool
+
+	// Fresh makes the lookup ask the server for its current record
+	// instead of using one the Client looked up before, in memory or
+	// on disk, so that a long-lived Client sees newly recorded digests.
+	// The record is still saved to the on-disk cache. Offline lookups
+	// ignore Fresh.
+	Fresh bool
 }
 
 // LookupOpts returns the record for the given key.
 func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte, err error) {
+	return c.LookupContext(context.Background(), key, opts)
+}
+
+// LookupContext returns the record for the given key.
+// If ctx is done before the lookup completes, LookupContext returns
+// an error wrapping ctx.Err(). Remote reads are only abandoned if
+// the Client's ClientOps implements ContextClientOps.
+//
+// Concurrent lookups of the same key or tile share a single request,
+// so a lookup may also fail with a context error if the lookup that
+// started the shared request is canceled. Failed lookups are not cached,
+// so a later lookup starts a new request, and neither are lookups for
+// a different Digest or Fresh lookups, so a long-lived Client sees newly
+// recorded digests.
+//
+// If the server reports that the record is pending, LookupContext
+// waits as long as the server asks, up to a limit, and tries again,
+// a few times, before failing with an error matching ErrPending.
+func (c *Client) LookupContext(ctx context.Context, key string, opts LookupOpts) (id int64, data []byte, err error) {
 	atomic.StoreUint32(&c.didLookup, 1)
 
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("%s: %v", key, err)
+			err = fmt.Errorf("%s: %w", key, err)
 		}
 	}()
 
-	if err := c.init(); err != nil {
+	r := &tileReader{c: c, ctx: ctx, offline: opts.Offline}
+
+	if err := c.init(r); err != nil {
 		return 0, nil, err
 	}
 
@@ -198,6 +441,18 @@ func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte,
 	remotePath := "/lookup/" + key
 	file := c.name + remotePath
 
+	// Offline lookups are cached separately, so that a failed offline
+	// lookup does not prevent a later online lookup of the same key.
+	cacheKey := file
+	if opts.Offline {
+		cacheKey = "offline:" + file
+	} else if opts.Digest != "" {
+		cacheKey = file + "#" + opts.Digest
+	}
+	if opts.Fresh && !opts.Offline {
+		cacheKey = "fresh:" + cacheKey
+	}
+
 	// Fetch the data.
 	// The lookupCache avoids redundant ReadCache/GetURL operations
 	// (especially since go.sum lines tend to come in pairs for a given
@@ -208,14 +463,26 @@ func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte,
 		text []byte
 		err  error
 	}
-	result := c.record.Do(file, func() interface{} {
+	result := c.record.Do(cacheKey, func() interface{} {
 		// Try the on-disk cache, or else get from web.
 		writeCache := false
 		data, err := c.ops.ReadCache(file)
+		if err != nil && opts.Offline {
+			return cached{err: fmt.Errorf("%w: record not in cache", ErrOffline)}
+		}
+		if err == nil && !opts.Offline && opts.Digest != "" && !hasDigest(data, opts.Digest) {
+			// The cached record does not vouch for the expected
+			// content, which may have changed since. Ask the server,
+			// which may have appended the new digest to the record.
+			err = errors.New("cached record lacks digest")
+		}
+		if err == nil && !opts.Offline && opts.Fresh {
+			err = errors.New("fresh lookup")
+		}
 		if err != nil {
 			q := url.Values{}
 			q.Set("h", opts.Digest)
-			data, err = c.ops.ReadRemote(remotePath, q.Encode())
+			data, err = c.readLookup(ctx, remotePath, q.Encode())
 			if err != nil {
 				return cached{err: err}
 			}
@@ -227,10 +494,12 @@ func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte,
 		if err != nil {
 			return cached{err: err}
 		}
-		if err := c.mergeLatest(treeMsg); err != nil {
+		// A record from the on-disk cache was checked when it was
+		// saved, so its tree head counts as stored.
+		if err := c.mergeLatest(r, treeMsg, !writeCache); err != nil {
 			return cached{err: err}
 		}
-		if err := c.checkRecord(id, text); err != nil {
+		if err := c.checkRecord(r, id, text); err != nil {
 			return cached{err: err}
 		}
 
@@ -242,6 +511,9 @@ func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte,
 
 		return cached{id, text, nil}
 	}).(cached)
+	if result.err != nil || opts.Fresh {
+		c.record.Delete(cacheKey)
+	}
 	if result.err != nil {
 		return 0, nil, result.err
 	}
@@ -249,6 +521,163 @@ func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte,
 	return result.id, result.text, nil
 }
 
+// hasDigest reports whether the record data
+// holds a line equal to digest.
+func hasDigest(data []byte, digest string) bool {
+	_, text, _, err := tlog.ParseRecord(data)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(text), "\n") {
+		if line == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// readRemote reads the content served at path on the remote database
+// server, using ReadRemoteContext if the ClientOps implements it.
+func (c *Client) readRemote(ctx context.Context, path, query string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ops, ok := c.ops.(ContextClientOps); ok {
+		return ops.ReadRemoteContext(ctx, path, query)
+	}
+	return c.ops.ReadRemote(path, query)
+}
+
+// maxPendingRetries is the number of times
+// readLookup retries a lookup of a pending record.
+const maxPendingRetries = 10
+
+// maxPendingWait and maxPendingTotal limit how long readLookup waits
+// before each retry and in all, whatever the server asks for.
+const (
+	maxPendingWait  = 30 * time.Second
+	maxPendingTotal = 2 * time.Minute
+)
+
+// readLookup reads the lookup result served at path. If the record is
+// still pending, it waits for the time the server asks for and retries,
+// up to maxPendingRetries times and within the limits of pendingWait.
+func (c *Client) readLookup(ctx context.Context, path, query string) ([]byte, error) {
+	var waited time.Duration
+	for i := 0; ; i++ {
+		data, err := c.readRemote(ctx, path, query)
+		d, ok := retryAfter(err)
+		if ok {
+			d, ok = pendingWait(d, waited)
+		}
+		if !ok || i >= maxPendingRetries {
+			return data, err
+		}
+		waited += d
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pendingWait returns how long to wait before retrying a lookup of a
+// pending record that the server asked to retry after d, having waited
+// for the record already. It waits at most maxPendingWait, and reports
+// false if waiting would exceed maxPendingTotal in all.
+func pendingWait(d, waited time.Duration) (time.Duration, bool) {
+	if d > maxPendingWait {
+		d = maxPendingWait
+	}
+	if waited+d > maxPendingTotal {
+		return 0, false
+	}
+	return d, true
+}
+
+// retryAfter reports whether err is for a pending record,
+// and if so, how long to wait before looking it up again.
+func retryAfter(err error) (time.Duration, bool) {
+	if !errors.Is(err, ErrPending) {
+		return 0, false
+	}
+	var pe *PendingError
+	var re *RemoteError
+	switch {
+	case errors.As(err, &pe):
+		return pe.RetryAfter, true
+	case errors.As(err, &re):
+		return re.RetryAfter, true
+	}
+	return time.Second, true
+}
+
+// isContextErr reports whether err is the result
+// of a canceled context or an expired deadline.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// LoadLatest is like Latest but first initializes the client, if necessary,
+// so that the latest tree head is loaded from the ClientOps configuration
+// even if the client has not yet done any lookups.
+func (c *Client) LoadLatest(ctx context.Context) (tlog.Tree, []byte, error) {
+	if err := c.init(&tileReader{c: c, ctx: ctx}); err != nil {
+		return tlog.Tree{}, nil, err
+	}
+	tree, msg := c.Latest()
+	return tree, msg, nil
+}
+
+// ProveRecord returns a proof that the record with the given id is
+// contained in tree, which must be a tree the client has authenticated,
+// such as the one returned by Latest. The hashes needed for the proof
+// are read from tiles in the on-disk cache or on the server,
+// or in proof mode, fetched from the server's proof endpoint.
+func (c *Client) ProveRecord(ctx context.Context, id int64, tree tlog.Tree) (tlog.RecordProof, error) {
+	r := &tileReader{c: c, ctx: ctx}
+	if err := c.init(r); err != nil {
+		return nil, err
+	}
+	if c.proofMode {
+		return c.readRecordProof(r, id, tree.N)
+	}
+	return tlog.ProveRecord(tree.N, id, tlog.TileHashReader(tree, r))
+}
+
+// FetchLatest returns the server's latest signed tree note
+// without checking it or merging it into the client's latest tree head.
+// Pass the result to MergeLatest to check it.
+func (c *Client) FetchLatest(ctx context.Context) ([]byte, error) {
+	return c.readRemote(ctx, "/latest", "")
+}
+
+// MergeLatest merges the signed tree note msg, such as one obtained from
+// another client of the same server, into the client's latest tree head.
+// It checks that msg is signed by the server and consistent with the
+// latest tree head, reading tiles from the server as necessary. If msg is
+// newer, it becomes the latest tree head. If msg is inconsistent, MergeLatest
+// reports the proof with SecurityError and returns an error wrapping ErrSecurity.
+func (c *Client) MergeLatest(ctx context.Context, msg []byte) error {
+	r := &tileReader{c: c, ctx: ctx}
+	if err := c.init(r); err != nil {
+		return err
+	}
+	return c.mergeLatest(r, msg, false)
+}
+
+// Latest returns the latest tree head known to the client
+// along with its encoded signed note.
+// Every record returned by a completed Lookup is contained in this tree.
+func (c *Client) Latest() (tlog.Tree, []byte) {
+	c.latestMu.Lock()
+	defer c.latestMu.Unlock()
+	return c.latest, c.latestMsg
+}
+
 // mergeLatest merges the tree head in msg
 // with the Client's current latest tree head,
 // ensuring the result is a consistent timeline.
@@ -258,9 +687,12 @@ func (c *Client) LookupOpts(key string, opts LookupOpts) (id int64, data []byte,
 // If the Client's current latest tree head moves forward,
 // mergeLatest updates the underlying configuration file as well,
 // taking care to merge any independent updates to that configuration.
-func (c *Client) mergeLatest(msg []byte) error {
+// Any tiles needed to check consistency are read using r.
+// If stored is true, msg was accepted before, so checkWitnesses
+// skips the checks that apply only to tree heads new from the server.
+func (c *Client) mergeLatest(r *tileReader, msg []byte, stored bool) error {
 	// Merge msg into our in-memory copy of the latest tree head.
-	when, err := c.mergeLatestMem(msg)
+	when, err := c.mergeLatestMem(r, msg, stored)
 	if err != nil {
 		return err
 	}
@@ -279,7 +711,7 @@ func (c *Client) mergeLatest(msg []byte) error {
 		if err != nil {
 			return err
 		}
-		when, err := c.mergeLatestMem(msg)
+		when, err := c.mergeLatestMem(r, msg, true)
 		if err != nil {
 			return err
 		}
@@ -314,7 +746,7 @@ const (
 // msgPast means msg was from before c.latest,
 // msgNow means msg was exactly c.latest, and
 // msgFuture means msg was from after c.latest, which has now been updated.
-func (c *Client) mergeLatestMem(msg []byte) (when int, err error) {
+func (c *Client) mergeLatestMem(r *tileReader, msg []byte, stored bool) (when int, err error) {
 	if len(msg) == 0 {
 		// Accept empty msg as the unsigned, empty timeline.
 		c.latestMu.Lock()
@@ -328,12 +760,18 @@ func (c *Client) mergeLatestMem(msg []byte) (when int, err error) {
 
 	note, err := note.Open(msg, c.verifiers)
 	if err != nil {
-		return 0, fmt.Errorf("reading tree note: %v\nnote:\n%s", err, msg)
+		return 0, fmt.Errorf("reading tree note: %w\nnote:\n%s", err, msg)
 	}
 	tree, err := tlog.ParseTree([]byte(note.Text))
 	if err != nil {
 		return 0, fmt.Errorf("reading tree: %v\ntree:\n%s", err, note.Text)
 	}
+	if err := c.checkWitnesses(r, note, tree, msg, stored); err != nil {
+		if errors.Is(err, ErrSecurity) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("reading tree note: %w\nnote:\n%s", err, msg)
+	}
 
 	// Other lookups may be calling mergeLatest with other heads,
 	// so c.latest is changing underfoot. We don't want to hold the
@@ -346,7 +784,7 @@ func (c *Client) mergeLatestMem(msg []byte) (when int, err error) {
 	for {
 		// If the tree head looks old, check that it is on our timeline.
 		if tree.N <= latest.N {
-			if err := c.checkTrees(tree, msg, latest, latestMsg); err != nil {
+			if err := c.checkTrees(r, tree, msg, latest, latestMsg); err != nil {
 				return 0, err
 			}
 			if tree.N < latest.N {
@@ -356,7 +794,7 @@ func (c *Client) mergeLatestMem(msg []byte) (when int, err error) {
 		}
 
 		// The tree head looks new. Check that we are on its timeline and try to move our timeline forward.
-		if err := c.checkTrees(latest, latestMsg, tree, msg); err != nil {
+		if err := c.checkTrees(r, latest, latestMsg, tree, msg); err != nil {
 			return 0, err
 		}
 
@@ -380,18 +818,140 @@ func (c *Client) mergeLatestMem(msg []byte) (when int, err error) {
 	}
 }
 
+// checkWitnesses checks that the verified signatures on n, the note
+// of tree in msg, include a signature by one of the log's keys and that
+// at least c.witnessThreshold witnesses cosigned either n or, as read
+// by readWitnessed, a tree head containing it. If stored is true, meaning
+// n was read from the configuration and so was accepted before, possibly
+// before witnesses were required, it checks neither the log key's validity
+// window nor the cosignatures; otherwise the log key must be valid now.
+func (c *Client) checkWitnesses(r *tileReader, n *note.Note, tree tlog.Tree, msg []byte, stored bool) error {
+	cosigned, err := c.checkSigs(n, stored)
+	if err != nil {
+		return err
+	}
+	if stored || len(cosigned) >= c.witnessThreshold {
+		return nil
+	}
+
+	c.latestMu.Lock()
+	witnessed := bytes.Equal(msg, c.witnessedMsg)
+	c.latestMu.Unlock()
+	if witnessed {
+		return nil
+	}
+	if len(c.witnessRemotes) > 0 && !r.offline {
+		if err := c.readWitnessed(r, tree, msg, cosigned); err != nil {
+			return err
+		}
+	}
+	if len(cosigned) < c.witnessThreshold {
+		return fmt.Errorf("%w: %d witness cosignatures, need %d", ErrNotWitnessed, len(cosigned), c.witnessThreshold)
+	}
+	c.latestMu.Lock()
+	c.witnessedMsg = msg
+	c.latestMu.Unlock()
+	return nil
+}
+
+// checkSigs checks that the verified signatures on n include a signature
+// by one of the log's keys, valid now unless stored is true, and returns
+// the names of the witnesses that cosigned n.
+func (c *Client) checkSigs(n *note.Note, stored bool) (map[string]bool, error) {
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	logSigned := false
+	expired := false
+	cosigned := make(map[string]bool)
+	for _, sig := range n.Sigs {
+		isLog := false
+		for _, k := range c.logKeys {
+			if sig.Name == k.verifier.Name() && sig.Hash == k.verifier.KeyHash() {
+				isLog = true
+				if stored || k.ValidAt(now) {
+					logSigned = true
+				} else {
+					expired = true
+				}
+			}
+		}
+		if isLog {
+			continue
+		}
+		for _, w := range c.witnesses {
+			if sig.Name == w.Name() && sig.Hash == w.KeyHash() {
+				cosigned[sig.Name] = true
+			}
+		}
+	}
+	if !logSigned {
+		if expired {
+			return nil, fmt.Errorf("signature by log key %s outside its validity window", c.name)
+		}
+		return nil, fmt.Errorf("missing signature by log key %s", c.name)
+	}
+	return cosigned, nil
+}
+
+// readWitnessed reads the latest cosigned tree head of each of
+// c.witnessRemotes and adds to cosigned the witnesses that cosigned
+// a tree head, signed by the log, that contains tree (from msg).
+// A witness that cannot be reached or serves a tree head that is
+// too old is skipped, but a cosigned tree head inconsistent with
+// tree is evidence of misbehavior, reported as by checkTrees.
+func (c *Client) readWitnessed(r *tileReader, tree tlog.Tree, msg []byte, cosigned map[string]bool) error {
+	for _, remote := range c.witnessRemotes {
+		wmsg, err := remote.ReadRemoteContext(r.ctx, "/latest", "")
+		if err != nil {
+			c.ops.Log(fmt.Sprintf("reading witness tree head: %v", err))
+			continue
+		}
+		wn, err := note.Open(wmsg, c.verifiers)
+		if err != nil {
+			c.ops.Log(fmt.Sprintf("reading witness tree note: %v", err))
+			continue
+		}
+		wcosigned, err := c.checkSigs(wn, false)
+		if err != nil {
+			c.ops.Log(fmt.Sprintf("reading witness tree note: %v", err))
+			continue
+		}
+		wtree, err := tlog.ParseTree([]byte(wn.Text))
+		if err != nil || wtree.N < tree.N {
+			continue
+		}
+		if err := c.checkTrees(r, tree, msg, wtree, wmsg); err != nil {
+			if errors.Is(err, ErrSecurity) {
+				return err
+			}
+			c.ops.Log(fmt.Sprintf("checking witness tree head: %v", err))
+			continue
+		}
+		for name := range wcosigned {
+			cosigned[name] = true
+		}
+	}
+	return nil
+}
+
 // checkTrees checks that older (from olderNote) is contained in newer (from newerNote).
 // If an error occurs, such as malformed data or a network problem, checkTrees returns that error.
 // If on the other hand checkTrees finds evidence of misbehavior, it prepares a detailed
-// message and calls log.Fatal.
-func (c *Client) checkTrees(older tlog.Tree, olderNote []byte, newer tlog.Tree, newerNote []byte) error {
-	thr := tlog.TileHashReader(newer, &c.tileReader)
+// message, passes it to c.ops.SecurityError and returns ErrSecurity. If c.ops implements
+// EvidenceClientOps, it first passes the Evidence to SecurityEvidence.
+func (c *Client) checkTrees(r *tileReader, older tlog.Tree, olderNote []byte, newer tlog.Tree, newerNote []byte) error {
+	if c.proofMode && !r.offline {
+		return c.checkTreesProof(r, older, olderNote, newer, newerNote)
+	}
+	thr := tlog.TileHashReader(newer, r)
 	h, err := tlog.TreeHash(older.N, thr)
 	if err != nil {
 		if older.N == newer.N {
-			return fmt.Errorf("checking tree#%d: %v", older.N, err)
+			return fmt.Errorf("checking tree#%d: %w", older.N, err)
 		}
-		return fmt.Errorf("checking tree#%d against tree#%d: %v", older.N, newer.N, err)
+		return fmt.Errorf("checking tree#%d against tree#%d: %w", older.N, newer.N, err)
 	}
 	if h == older.Hash {
 		return nil
@@ -427,13 +987,23 @@ func (c *Client) checkTrees(older tlog.Tree, olderNote []byte, newer tlog.Tree,
 		for _, h := range p {
 			fmt.Fprintf(&buf, "\n\t%v", h)
 		}
+		if ops, ok := c.ops.(EvidenceClientOps); ok {
+			ops.SecurityEvidence(&Evidence{
+				OlderNote: string(olderNote),
+				NewerNote: string(newerNote),
+				OlderSize: older.N,
+				NewerSize: newer.N,
+				Hash:      h,
+				Proof:     p,
+			})
+		}
 	}
 	c.ops.SecurityError(buf.String())
 	return ErrSecurity
 }
 
 // checkRecord checks that record #id's hash matches data.
-func (c *Client) checkRecord(id int64, data []byte) error {
+func (c *Client) checkRecord(r *tileReader, id int64, data []byte) error {
 	c.latestMu.Lock()
 	latest := c.latest
 	c.latestMu.Unlock()
@@ -441,7 +1011,10 @@ func (c *Client) checkRecord(id int64, data []byte) error {
 	if id >= latest.N {
 		return fmt.Errorf("cannot validate record %d in tree of size %d", id, latest.N)
 	}
-	hashes, err := tlog.TileHashReader(latest, &c.tileReader).ReadHashes([]int64{tlog.StoredHashIndex(0, id)})
+	if c.proofMode && !r.offline {
+		return c.checkRecordProof(r, latest, id, data)
+	}
+	hashes, err := tlog.TileHashReader(latest, r).ReadHashes([]int64{tlog.StoredHashIndex(0, id)})
 	if err != nil {
 		return err
 	}
@@ -453,9 +1026,12 @@ func (c *Client) checkRecord(id int64, data []byte) error {
 
 // tileReader is a *Client wrapper that implements tlog.TileReader.
 // The separate type avoids exposing the ReadTiles and SaveTiles
-// methods on Client itself.
+// methods on Client itself. It also carries the settings of the
+// lookup it is reading tiles for.
 type tileReader struct {
-	c *Client
+	c       *Client
+	ctx     context.Context // context of the lookup
+	offline bool            // read tiles only from the on-disk cache
 }
 
 func (r *tileReader) Height() int {
@@ -473,7 +1049,11 @@ func (r *tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
 		wg.Add(1)
 		go func(i int, tile tlog.Tile) {
 			defer wg.Done()
-			data[i], errs[i] = r.c.readTile(tile)
+			if r.offline {
+				data[i], errs[i] = r.c.readCachedTile(tile)
+			} else {
+				data[i], errs[i] = r.c.readTile(r.ctx, tile)
+			}
 		}(i, tile)
 	}
 	wg.Wait()
@@ -498,7 +1078,7 @@ func (c *Client) tileRemotePath(tile tlog.Tile) string {
 }
 
 // readTile reads a single tile, either from the on-disk cache or the server.
-func (c *Client) readTile(tile tlog.Tile) ([]byte, error) {
+func (c *Client) readTile(ctx context.Context, tile tlog.Tile) ([]byte, error) {
 	type cached struct {
 		data []byte
 		err  error
@@ -506,27 +1086,15 @@ func (c *Client) readTile(tile tlog.Tile) ([]byte, error) {
 
 	result := c.tileCache.Do(tile, func() interface{} {
 		// Try the requested tile in on-disk cache.
-		data, err := c.ops.ReadCache(c.tileCacheKey(tile))
+		data, err := c.readCachedTile(tile)
 		if err == nil {
-			c.markTileSaved(tile)
 			return cached{data, nil}
 		}
 
-		// Try the full tile in on-disk cache (if requested tile not already full).
-		// We only save authenticated tiles to the on-disk cache,
-		// so the recreated prefix is equally authenticated.
+		// Try requested tile from server.
 		full := tile
 		full.W = 1 << uint(tile.H)
-		if tile != full {
-			data, err := c.ops.ReadCache(c.tileCacheKey(full))
-			if err == nil {
-				c.markTileSaved(tile) // don't save tile later; we already have full
-				return cached{data[:len(data)/full.W*tile.W], nil}
-			}
-		}
-
-		// Try requested tile from server.
-		data, err = c.ops.ReadRemote(c.tileRemotePath(tile), "")
+		data, err = c.readRemote(ctx, c.tileRemotePath(tile), "")
 		if err == nil {
 			return cached{data, nil}
 		}
@@ -536,7 +1104,7 @@ func (c *Client) readTile(tile tlog.Tile) ([]byte, error) {
 		// the tile has been completed and only the complete one
 		// is available.
 		if tile != full {
-			data, err := c.ops.ReadRemote(c.tileRemotePath(full), "")
+			data, err := c.readRemote(ctx, c.tileRemotePath(full), "")
 			if err == nil {
 				// Note: We could save the full tile in the on-disk cache here,
 				// but we don't know if it is valid yet, and we will only find out
@@ -551,10 +1119,39 @@ func (c *Client) readTile(tile tlog.Tile) ([]byte, error) {
 		// Return the error from the server fetch for the requested (not full) tile.
 		return cached{nil, err}
 	}).(cached)
+	if isContextErr(result.err) {
+		c.tileCache.Delete(tile)
+	}
 
 	return result.data, result.err
 }
 
+// readCachedTile reads a single tile from the on-disk cache,
+// returning an error wrapping ErrOffline if the tile is not cached.
+func (c *Client) readCachedTile(tile tlog.Tile) ([]byte, error) {
+	// Try the requested tile in on-disk cache.
+	data, err := c.ops.ReadCache(c.tileCacheKey(tile))
+	if err == nil {
+		c.markTileSaved(tile)
+		return data, nil
+	}
+
+	// Try the full tile in on-disk cache (if requested tile not already full).
+	// We only save authenticated tiles to the on-disk cache,
+	// so the recreated prefix is equally authenticated.
+	full := tile
+	full.W = 1 << uint(tile.H)
+	if tile != full {
+		data, err := c.ops.ReadCache(c.tileCacheKey(full))
+		if err == nil {
+			c.markTileSaved(tile) // don't save tile later; we already have full
+			return data[:len(data)/full.W*tile.W], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: tile %s not in cache", ErrOffline, tile.Path())
+}
+
 // markTileSaved records that tile is already present in the on-disk cache,
 // so that a future SaveTiles for that tile can be ignored.
 func (c *Client) markTileSaved(tile tlog.Tile) {
@@ -6,10 +6,16 @@ package sumdb
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"go.transparencylog.com/mod/sumdb/note"
 	"go.transparencylog.com/mod/sumdb/tlog"
@@ -48,6 +54,466 @@ func TestClientLookup(t *testing.T) {
 	tc.mustHaveLatest(4)
 }
 
+func TestClientOffline(t *testing.T) {
+	tc := newTestClient(t)
+	tc.getOK = false
+
+	// Nothing is cached yet.
+	_, _, err := tc.client.LookupOpts("rsc.io/sampler@v1.3.0", LookupOpts{Offline: true})
+	if !errors.Is(err, ErrOffline) {
+		t.Fatalf("offline lookup of uncached record: err = %v, want ErrOffline", err)
+	}
+
+	// A failed offline lookup must not prevent an online one.
+	tc.getOK = true
+	tc.mustLookup("rsc.io/sampler", "v1.3.0", "rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=\nrsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=")
+
+	// With the record and its tiles cached, a new client
+	// can look it up offline.
+	tc.getOK = false
+	tc.newClient()
+	_, data, err := tc.client.LookupOpts("rsc.io/sampler@v1.3.0", LookupOpts{Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "rsc.io/sampler v1.3.0 h1:") {
+		t.Fatalf("offline lookup returned:\n%s", data)
+	}
+
+	// A record that was never fetched is still unavailable.
+	_, _, err = tc.client.LookupOpts("rsc.io/!quote@v1.5.2", LookupOpts{Offline: true})
+	if !errors.Is(err, ErrOffline) {
+		t.Fatalf("offline lookup of uncached record: err = %v, want ErrOffline", err)
+	}
+
+	// A cached record whose tiles are missing cannot be authenticated.
+	for file := range tc.cache {
+		if strings.Contains(file, "/tile/") {
+			delete(tc.cache, file)
+		}
+	}
+	tc.newClient()
+	_, _, err = tc.client.LookupOpts("rsc.io/sampler@v1.3.0", LookupOpts{Offline: true})
+	if !errors.Is(err, ErrOffline) {
+		t.Fatalf("offline lookup without tiles: err = %v, want ErrOffline", err)
+	}
+}
+
+func TestClientCanceled(t *testing.T) {
+	tc := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := tc.client.LookupContext(ctx, "rsc.io/sampler@v1.3.0", LookupOpts{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled lookup: err = %v, want context.Canceled", err)
+	}
+
+	// The canceled lookup must not be cached.
+	tc.mustLookup("rsc.io/sampler", "v1.3.0", "rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=\nrsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=")
+	tc.mustHaveLatest(3)
+}
+
+func TestClientWitnesses(t *testing.T) {
+	tc := newTestClient(t)
+
+	var wkeys []string
+	var witnesses []note.Signer
+	for _, name := range []string{"witness1.localdev", "witness2.localdev", "witness3.localdev"} {
+		skey, vkey, err := note.GenerateKey(rand.Reader, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := note.NewSigner(skey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wkeys = append(wkeys, vkey)
+		witnesses = append(witnesses, signer)
+	}
+
+	// Tree heads signed only by the log are rejected.
+	tc.client.SetWitnesses(2, wkeys)
+	_, _, err := tc.client.Lookup("rsc.io/sampler@v1.3.0")
+	if !errors.Is(err, ErrNotWitnessed) {
+		t.Fatalf("lookup without cosignatures: err = %v, want ErrNotWitnessed", err)
+	}
+
+	// One cosignature is not enough.
+	tc.cosigners = witnesses[:1]
+	tc.config[testName+"/latest"] = tc.signTree(1)
+	tc.addRecord("rsc.io/pkg1@v1.0.0", "rsc.io/pkg1 v1.0.0 h1:hash!=\n")
+	tc.newClient()
+	tc.client.SetWitnesses(2, wkeys)
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.0")
+	if !errors.Is(err, ErrNotWitnessed) {
+		t.Fatalf("lookup with one cosignature: err = %v, want ErrNotWitnessed", err)
+	}
+
+	// Two of three cosignatures are.
+	tc.cosigners = witnesses[1:]
+	tc.config[testName+"/latest"] = tc.signTree(1)
+	tc.addRecord("rsc.io/pkg1@v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=\n")
+	tc.newClient()
+	tc.client.SetWitnesses(2, wkeys)
+	tc.mustLookup("rsc.io/pkg1", "v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=")
+
+	// Witnesses cannot stand in for the log's own signature.
+	text := tlog.FormatTree(tlog.Tree{N: 1, Hash: tc.hashes[0]})
+	data, err := note.Sign(&note.Note{Text: string(text)}, witnesses...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.config[testName+"/latest"] = data
+	tc.newClient()
+	tc.client.SetWitnesses(2, wkeys)
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.1")
+	tc.mustError(err, "missing signature by log key")
+}
+
+func TestClientWitnessesCached(t *testing.T) {
+	tc := newTestClient(t)
+	const sampler = "rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=\nrsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA="
+	tc.mustLookup("rsc.io/sampler", "v1.3.0", sampler)
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "witness1.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requiring witnesses does not reject the tree head
+	// already accepted and stored before they were required.
+	tc.newClient()
+	tc.client.SetWitnesses(1, []string{vkey})
+	if _, _, err := tc.client.LookupOpts("rsc.io/sampler@v1.3.0", LookupOpts{Offline: true}); err != nil {
+		t.Fatalf("offline lookup with cached tree head: %v", err)
+	}
+
+	// Tree heads from the server must still be cosigned.
+	tc.addRecord("rsc.io/pkg1@v1.0.0", "rsc.io/pkg1 v1.0.0 h1:hash!=\n")
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.0")
+	if !errors.Is(err, ErrNotWitnessed) {
+		t.Fatalf("lookup without cosignature: err = %v, want ErrNotWitnessed", err)
+	}
+	tc.cosigners = []note.Signer{witness}
+	tc.addRecord("rsc.io/pkg1@v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=\n")
+	tc.mustLookup("rsc.io/pkg1", "v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=")
+}
+
+// witnessRemote is a Remote serving a witness's cosigned tree head.
+type witnessRemote struct {
+	latest []byte
+}
+
+func (w *witnessRemote) ReadRemoteContext(ctx context.Context, path, query string) ([]byte, error) {
+	if path != "/latest" || w.latest == nil {
+		return nil, &RemoteError{Path: path, StatusCode: 503, Status: "503 Service Unavailable"}
+	}
+	return w.latest, nil
+}
+
+func TestClientWitnessRemotes(t *testing.T) {
+	tc := newTestClient(t)
+
+	var wkeys []string
+	var witnesses []note.Signer
+	var remotes []Remote
+	for _, name := range []string{"witness1.localdev", "witness2.localdev", "witness3.localdev"} {
+		skey, vkey, err := note.GenerateKey(rand.Reader, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := note.NewSigner(skey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wkeys = append(wkeys, vkey)
+		witnesses = append(witnesses, signer)
+		remotes = append(remotes, new(witnessRemote))
+	}
+	cosign := func(tc *testClient, size int64, w note.Signer) []byte {
+		tc.cosigners = []note.Signer{w}
+		defer func() { tc.cosigners = nil }()
+		return tc.signTree(size)
+	}
+	newClient := func() {
+		tc.newClient()
+		tc.client.SetWitnesses(2, wkeys)
+		tc.client.SetWitnessRemotes(remotes)
+	}
+
+	// Without cosigned tree heads from the witnesses,
+	// tree heads signed only by the log are rejected.
+	newClient()
+	_, _, err := tc.client.Lookup("rsc.io/sampler@v1.3.0")
+	if !errors.Is(err, ErrNotWitnessed) {
+		t.Fatalf("lookup without cosignatures: err = %v, want ErrNotWitnessed", err)
+	}
+
+	// Two witnesses that cosigned the server's tree head,
+	// or a later one, are enough.
+	remotes[0].(*witnessRemote).latest = cosign(tc, tc.treeSize, witnesses[0])
+	tc.addRecord("rsc.io/pkg1@v1.0.0", "rsc.io/pkg1 v1.0.0 h1:hash!=\n")
+	remotes[1].(*witnessRemote).latest = cosign(tc, tc.treeSize, witnesses[1])
+	newClient()
+	tc.mustLookup("rsc.io/sampler", "v1.3.0", "rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=\nrsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=")
+
+	// A tree head newer than the witnessed ones is rejected,
+	// and so is one cosigned only on a fork of the log.
+	tc2 := tc.fork()
+	tc.addRecord("rsc.io/pkg1@v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=\n")
+	tc2.addRecord("rsc.io/pkg1@v1.0.1", "rsc.io/pkg1 v1.0.1 h1:fork!=\n")
+	remotes[2].(*witnessRemote).latest = cosign(tc2, tc2.treeSize, witnesses[2])
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.1")
+	if !errors.Is(err, ErrNotWitnessed) {
+		t.Fatalf("lookup of unwitnessed tree head: err = %v, want ErrNotWitnessed", err)
+	}
+
+	// Once the witnesses catch up, it is accepted.
+	remotes[1].(*witnessRemote).latest = cosign(tc, tc.treeSize, witnesses[1])
+	remotes[2].(*witnessRemote).latest = cosign(tc, tc.treeSize, witnesses[2])
+	newClient()
+	tc.mustLookup("rsc.io/pkg1", "v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=")
+	if tc.security.Len() > 0 {
+		t.Fatalf("unexpected security error: %s", tc.security.String())
+	}
+
+	// Witness cosignatures cannot stand in for the log's own signature.
+	tc.addRecord("rsc.io/pkg1@v1.0.2", "rsc.io/pkg1 v1.0.2 h1:hash!=\n")
+	text := tlog.FormatTree(tlog.Tree{N: tc.treeSize, Hash: tc.hashes[0]})
+	for i, w := range witnesses {
+		data, err := note.Sign(&note.Note{Text: string(text)}, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remotes[i].(*witnessRemote).latest = data
+	}
+	newClient()
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.2")
+	if !errors.Is(err, ErrNotWitnessed) {
+		t.Fatalf("lookup with witness-only tree heads: err = %v, want ErrNotWitnessed", err)
+	}
+}
+
+func TestClientLookupDigest(t *testing.T) {
+	tc := newTestClient(t)
+	tc.addRecord("example.com/a", "example.com/a\nh1:old=\n")
+	if _, _, err := tc.client.Lookup("example.com/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached record serves lookups for a digest it holds.
+	tc.getOK = false
+	tc.newClient()
+	if _, data, err := tc.client.LookupOpts("example.com/a", LookupOpts{Digest: "h1:old="}); err != nil || string(data) != "example.com/a\nh1:old=\n" {
+		t.Fatalf("LookupOpts(h1:old=) = %q, %v", data, err)
+	}
+
+	// A lookup for a digest it does not hold asks the server again.
+	tc.getOK = true
+	tc.addRecord("example.com/a", "example.com/a\nh1:old=\nh1:new=\n")
+	tc.newClient()
+	id, data, err := tc.client.LookupOpts("example.com/a", LookupOpts{Digest: "h1:new="})
+	if err != nil || id != tc.treeSize-1 || string(data) != "example.com/a\nh1:old=\nh1:new=\n" {
+		t.Fatalf("LookupOpts(h1:new=) = %d, %q, %v", id, data, err)
+	}
+}
+
+func TestClientLookupFresh(t *testing.T) {
+	tc := newTestClient(t)
+	tc.addRecord("example.com/a", "example.com/a\nh1:old=\n")
+	if _, _, err := tc.client.Lookup("example.com/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plain lookups keep returning the record looked up before.
+	tc.addRecord("example.com/a", "example.com/a\nh1:old=\nh1:new=\n")
+	if _, data, err := tc.client.Lookup("example.com/a"); err != nil || string(data) != "example.com/a\nh1:old=\n" {
+		t.Fatalf("Lookup = %q, %v, want cached record", data, err)
+	}
+
+	// A fresh lookup asks the server, every time.
+	for i := 0; i < 2; i++ {
+		id, data, err := tc.client.LookupOpts("example.com/a", LookupOpts{Fresh: true})
+		if err != nil || id != tc.treeSize-1 || string(data) != "example.com/a\nh1:old=\nh1:new=\n" {
+			t.Fatalf("fresh LookupOpts = %d, %q, %v", id, data, err)
+		}
+	}
+	tc.getOK = false
+	if _, _, err := tc.client.LookupOpts("example.com/a", LookupOpts{Fresh: true}); err == nil {
+		t.Fatal("fresh LookupOpts succeeded without the server")
+	}
+}
+
+func TestClientProofMode(t *testing.T) {
+	tc := newTestClient(t)
+	tc.getTileOK = false
+	tc.client.SetProofMode()
+
+	// Lookups check the record and the newer tree with proofs alone.
+	tc.mustLookup("rsc.io/sampler", "v1.3.0", "rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=\nrsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=")
+	tc.mustHaveLatest(3)
+	tc.addRecord("rsc.io/pkg1@v1.5.2", `rsc.io/pkg1 v1.5.2 h1:hash!=
+`)
+	tc.mustLookup("rsc.io/pkg1", "v1.5.2", "rsc.io/pkg1 v1.5.2 h1:hash!=")
+	tc.mustHaveLatest(5)
+
+	latest, _ := tc.client.Latest()
+	p, err := tc.client.ProveRecord(context.Background(), 2, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tlog.CheckRecord(p, latest.N, latest.Hash, 2, tc.hashes[tlog.StoredHashIndex(0, 2)]); err != nil {
+		t.Fatalf("ProveRecord: %v", err)
+	}
+
+	// A tampered record is rejected.
+	key := "/lookup/rsc.io/quote@v1.5.2"
+	tc.remote[key] = bytes.Replace(tc.remote[key], []byte("xyzzy"), []byte("xyzzz"), 1)
+	_, _, err = tc.client.Lookup("rsc.io/quote@v1.5.2")
+	tc.mustError(err, "cannot authenticate record data")
+
+	// A fork is detected by its failing consistency proof.
+	tc2 := tc.fork()
+	tc2.client.SetProofMode()
+	tc.addRecord("rsc.io/pkg2@v1.0.0", `rsc.io/pkg2 v1.0.0 h1:hash!=
+`)
+	tc2.addRecord("rsc.io/pkg1@v1.5.3", `rsc.io/pkg1 v1.5.3 h1:hash!=
+`)
+	tc2.addRecord("rsc.io/pkg1@v1.5.4", `rsc.io/pkg1 v1.5.4 h1:hash!=
+`)
+	tc2.mustLookup("rsc.io/pkg1", "v1.5.4", "rsc.io/pkg1 v1.5.4 h1:hash!=")
+	key = "/lookup/rsc.io/pkg2@v1.0.0"
+	tc2.remote[key] = tc.remote[key]
+	_, _, err = tc2.client.Lookup("rsc.io/pkg2@v1.0.0")
+	if !errors.Is(err, ErrSecurity) {
+		t.Fatalf("err = %v, want errors.Is(err, ErrSecurity)", err)
+	}
+	if !strings.Contains(tc2.security.String(), "proof that the old tree is contained in the new tree does not verify") {
+		t.Fatalf("security text:\n%s", tc2.security.String())
+	}
+}
+
+func TestClientPending(t *testing.T) {
+	tc := newTestClient(t)
+
+	// A pending record is looked up again until it is in the log.
+	tc.pending = 3
+	tc.mustLookup("rsc.io/sampler", "v1.3.0", "rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=\nrsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=")
+
+	// A record that stays pending fails, but the failure is not cached.
+	tc.pending = maxPendingRetries + 1
+	_, _, err := tc.client.Lookup("rsc.io/quote@v1.5.2")
+	if !errors.Is(err, ErrPending) {
+		t.Fatalf("err = %v, want errors.Is(err, ErrPending)", err)
+	}
+	tc.mustLookup("rsc.io/quote", "v1.5.2", "rsc.io/quote v1.5.2 h1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y=\nrsc.io/quote v1.5.2/go.mod h1:LzX7hefJvL54yjefDEDHNONDjII0t9xZLPXsUe+TKr0=\nrsc.io/quote v1.5.2 h2:xyzzy")
+
+	// A server reports a pending record with 503 and Retry-After.
+	re := &RemoteError{Path: "/lookup/x", StatusCode: 503, RetryAfter: 2 * time.Second}
+	if d, ok := retryAfter(fmt.Errorf("x: %w", re)); !ok || d != 2*time.Second {
+		t.Fatalf("retryAfter(503) = %v, %v, want 2s, true", d, ok)
+	}
+	if _, ok := retryAfter(&RemoteError{Path: "/lookup/x", StatusCode: 503}); ok {
+		t.Fatalf("retryAfter(503 without Retry-After) = true, want false")
+	}
+
+	// Long waits are cut short, and so is waiting in all.
+	for _, tt := range []struct {
+		d, waited, want time.Duration
+		ok              bool
+	}{
+		{time.Second, 0, time.Second, true},
+		{time.Hour, 0, maxPendingWait, true},
+		{time.Hour, maxPendingTotal - maxPendingWait, maxPendingWait, true},
+		{time.Hour, maxPendingTotal - time.Second, 0, false},
+		{time.Second, maxPendingTotal, 0, false},
+	} {
+		if d, ok := pendingWait(tt.d, tt.waited); d != tt.want || ok != tt.ok {
+			t.Errorf("pendingWait(%v, %v) = %v, %v, want %v, %v", tt.d, tt.waited, d, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClientKeyRotation(t *testing.T) {
+	tc := newTestClient(t)
+	skey, vkey, err := note.GenerateKey(rand.Reader, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer2, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.config["key"] = []byte("# rotated in 2030\n" +
+		testVerifierKey + " not-after=2030-06-01T00:00:00Z\n" +
+		vkey + " not-before=2030-01-01T00:00:00Z\n")
+	newClient := func(now string) {
+		tc.newClient()
+		tc.client.now = func() time.Time {
+			tm, _ := time.Parse(time.RFC3339, now)
+			return tm
+		}
+	}
+
+	// Before the rotation, heads signed by the new key are rejected.
+	tc.signer = signer2
+	tc.addRecord("rsc.io/pkg1@v1.0.0", "rsc.io/pkg1 v1.0.0 h1:hash!=\n")
+	newClient("2029-01-01T00:00:00Z")
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.0")
+	tc.mustError(err, "outside its validity window")
+
+	// Once it is valid, they are accepted,
+	// along with the stored head signed by the old key.
+	newClient("2030-02-01T00:00:00Z")
+	tc.mustLookup("rsc.io/pkg1", "v1.0.0", "rsc.io/pkg1 v1.0.0 h1:hash!=")
+
+	// After the old key expires, heads signed by it are rejected,
+	// but the stored head signed by the new key is still accepted.
+	tc.signer, err = note.NewSigner(testSignerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.addRecord("rsc.io/pkg1@v1.0.1", "rsc.io/pkg1 v1.0.1 h1:hash!=\n")
+	newClient("2031-01-01T00:00:00Z")
+	_, _, err = tc.client.Lookup("rsc.io/pkg1@v1.0.1")
+	tc.mustError(err, "outside its validity window")
+}
+
+func TestClientMergeLatest(t *testing.T) {
+	tc := newTestClient(t)
+	tc2 := tc.fork()
+	ctx := context.Background()
+
+	// A newer consistent tree head from a peer becomes the latest.
+	if err := tc.client.MergeLatest(ctx, tc.signTree(tc.treeSize)); err != nil {
+		t.Fatal(err)
+	}
+	tc.mustHaveLatest(4)
+	tree, _, err := tc.client.LoadLatest(ctx)
+	if err != nil || tree.N != 4 {
+		t.Fatalf("LoadLatest() = %v, %v, want tree 4", tree, err)
+	}
+
+	// A peer's tree head from a split view is a security error.
+	tc.addRecord("rsc.io/pkg1@v1.5.2", "rsc.io/pkg1 v1.5.2 h1:hash!=\n")
+	tc2.addRecord("rsc.io/pkg1@v1.5.3", "rsc.io/pkg1 v1.5.3 h1:hash!=\n")
+	if err := tc.client.MergeLatest(ctx, tc.signTree(tc.treeSize)); err != nil {
+		t.Fatal(err)
+	}
+	err = tc.client.MergeLatest(ctx, tc2.signTree(tc2.treeSize))
+	if !errors.Is(err, ErrSecurity) {
+		t.Fatalf("MergeLatest of forked tree: err = %v, want ErrSecurity", err)
+	}
+	if !strings.Contains(tc.security.String(), "proof of misbehavior") {
+		t.Fatalf("security error does not report proof:\n%s", tc.security.String())
+	}
+}
+
 func TestClientBadTiles(t *testing.T) {
 	tc := newTestClient(t)
 
@@ -110,6 +576,9 @@ func TestClientFork(t *testing.T) {
 	tc2.remote[key] = tc.remote[key]
 	_, _, err := tc2.client.Lookup("rsc.io/pkg1@v1.5.2")
 	tc2.mustError(err, ErrSecurity.Error())
+	if !errors.Is(err, ErrSecurity) {
+		t.Fatalf("err = %v, want errors.Is(err, ErrSecurity)", err)
+	}
 
 	_ = `SECURITY ERROR
 go.sum database server misbehavior detected!
@@ -151,6 +620,93 @@ proof of misbehavior:
 	}
 }
 
+func TestClientEvidence(t *testing.T) {
+	tc := newTestClient(t)
+	tc2 := tc.fork()
+
+	tc.addRecord("rsc.io/pkg1@v1.5.2", "rsc.io/pkg1 v1.5.2 h1:hash!=\n")
+	tc2.addRecord("rsc.io/pkg1@v1.5.3", "rsc.io/pkg1 v1.5.3 h1:hash!=\n")
+	tc2.addRecord("rsc.io/pkg1@v1.5.4", "rsc.io/pkg1 v1.5.4 h1:hash!=\n")
+	ctx := context.Background()
+	if err := tc2.client.MergeLatest(ctx, tc2.signTree(tc2.treeSize)); err != nil {
+		t.Fatal(err)
+	}
+	err := tc2.client.MergeLatest(ctx, tc.signTree(tc.treeSize))
+	if !errors.Is(err, ErrSecurity) {
+		t.Fatalf("MergeLatest of forked tree: err = %v, want ErrSecurity", err)
+	}
+	if len(tc2.evidence) != 1 {
+		t.Fatalf("fork reported %d pieces of evidence, want 1", len(tc2.evidence))
+	}
+	e := tc2.evidence[0]
+	if e.OlderSize != 5 || e.NewerSize != 6 {
+		t.Fatalf("evidence for trees %d and %d, want 5 and 6", e.OlderSize, e.NewerSize)
+	}
+
+	// The evidence stands on its own: it survives a round trip
+	// through JSON and checks without the client or the server.
+	js, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = new(Evidence)
+	if err := json.Unmarshal(js, e); err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(testVerifierKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers := note.VerifierList(verifier)
+	if err := e.Verify(verifiers); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// Tampered evidence does not check.
+	bad := *e
+	bad.Proof = bad.Proof[1:]
+	if err := bad.Verify(verifiers); err == nil {
+		t.Fatal("Verify accepted a truncated proof")
+	}
+	bad = *e
+	bad.NewerNote = e.OlderNote
+	if err := bad.Verify(verifiers); err == nil {
+		t.Fatal("Verify accepted a mislabeled note")
+	}
+	_, otherKey, err := note.GenerateKey(rand.Reader, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := note.NewVerifier(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Verify(note.VerifierList(other)); err == nil {
+		t.Fatal("Verify accepted notes signed by another key")
+	}
+
+	// Evidence of consistent trees shows no misbehavior.
+	h, err := tlog.TreeHash(5, tc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := tlog.ProveTree(6, 5, tc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := &Evidence{
+		OlderNote: string(tc2.signTree(5)),
+		NewerNote: string(tc2.signTree(6)),
+		OlderSize: 5,
+		NewerSize: 6,
+		Hash:      h,
+		Proof:     p,
+	}
+	if err := good.Verify(verifiers); err != ErrNoMisbehavior {
+		t.Fatalf("Verify of consistent trees: err = %v, want ErrNoMisbehavior", err)
+	}
+}
+
 // A testClient is a self-contained client-side testing environment.
 type testClient struct {
 	t          *testing.T // active test
@@ -162,8 +718,9 @@ type testClient struct {
 	hashes     []tlog.Hash
 	remote     map[string][]byte
 	signer     note.Signer
+	cosigners  []note.Signer // witnesses cosigning new tree heads
 
-	// mu protects config, cache, log, security
+	// mu protects config, cache, pending, log, security
 	// during concurrent use of the exported methods
 	// by the client itself (testClient is the Client's ClientOps,
 	// and the Client methods can both read and write these fields).
@@ -180,7 +737,9 @@ type testClient struct {
 	mu       sync.Mutex // prot
 	config   map[string][]byte
 	cache    map[string][]byte
+	pending  int // number of lookups to report as pending
 	security bytes.Buffer
+	evidence []*Evidence
 }
 
 // newTestClient returns a new testClient that will call t.Fatal on error
@@ -339,7 +898,8 @@ func (tc *testClient) signTree(size int64) []byte {
 		tc.t.Fatal(err)
 	}
 	text := tlog.FormatTree(tlog.Tree{N: size, Hash: h})
-	data, err := note.Sign(&note.Note{Text: string(text)}, tc.signer)
+	signers := append([]note.Signer{tc.signer}, tc.cosigners...)
+	data, err := note.Sign(&note.Note{Text: string(text)}, signers...)
 	if err != nil {
 		tc.t.Fatal(err)
 	}
@@ -356,6 +916,20 @@ func (tc *testClient) ReadRemote(path string, query string) ([]byte, error) {
 	if strings.Contains(path, "/tile/") && !tc.getTileOK {
 		return nil, fmt.Errorf("disallowed remote tile read %s", path)
 	}
+	if strings.HasPrefix(path, "/proof/") {
+		return tc.readProof(path, query)
+	}
+	if strings.HasPrefix(path, "/lookup/") {
+		tc.mu.Lock()
+		pending := tc.pending > 0
+		if pending {
+			tc.pending--
+		}
+		tc.mu.Unlock()
+		if pending {
+			return nil, &PendingError{Key: strings.TrimPrefix(path, "/lookup/"), RetryAfter: time.Millisecond}
+		}
+	}
 
 	data, ok := tc.remote[path]
 	if !ok {
@@ -364,6 +938,32 @@ func (tc *testClient) ReadRemote(path string, query string) ([]byte, error) {
 	return data, nil
 }
 
+// readProof serves the proof endpoints from tc's hashes.
+func (tc *testClient) readProof(path, query string) ([]byte, error) {
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var a, b int64
+	var p []tlog.Hash
+	switch path {
+	case "/proof/record":
+		fmt.Sscan(q.Get("id"), &a)
+		fmt.Sscan(q.Get("tree"), &b)
+		p, err = tlog.ProveRecord(b, a, tc)
+	case "/proof/tree":
+		fmt.Sscan(q.Get("old"), &a)
+		fmt.Sscan(q.Get("new"), &b)
+		p, err = tlog.ProveTree(b, a, tc)
+	default:
+		return nil, fmt.Errorf("no remote path %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return formatProof(p), nil
+}
+
 // ReadConfig is for tc's implementation of Client.
 func (tc *testClient) ReadConfig(file string) ([]byte, error) {
 	tc.mu.Lock()
@@ -421,3 +1021,11 @@ func (tc *testClient) SecurityError(msg string) {
 
 	fmt.Fprintf(&tc.security, "%s\n", strings.TrimRight(msg, "\n"))
 }
+
+// SecurityEvidence is for tc's implementation of Client.
+func (tc *testClient) SecurityEvidence(e *Evidence) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.evidence = append(tc.evidence, e)
+}
@@ -0,0 +1,83 @@
+package sumdb
+
+import (
+	"errors"
+	"fmt"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+// An EvidenceClientOps is a ClientOps that can also keep structured
+// evidence of server misbehavior. If the ClientOps passed to NewClient
+// implements EvidenceClientOps, the Client passes the Evidence of any
+// fork it detects to SecurityEvidence before calling SecurityError.
+type EvidenceClientOps interface {
+	ClientOps
+
+	// SecurityEvidence records the evidence of a fork.
+	SecurityEvidence(e *Evidence)
+}
+
+// Evidence proves that a server misbehaved by signing two tree heads
+// that are not consistent with each other: the hash that the newer
+// tree proves for its first OlderSize records differs from the hash
+// of the older tree. It can be checked by anyone holding the server's
+// verifier key, without access to the server.
+type Evidence struct {
+	OlderNote string `json:"older_note"` // signed note of the older tree
+	NewerNote string `json:"newer_note"` // signed note of the newer tree
+	OlderSize int64  `json:"older_size"`
+	NewerSize int64  `json:"newer_size"`
+
+	// Hash is the hash of the first OlderSize records in the newer tree,
+	// and Proof proves it from the newer tree's hash.
+	Hash  tlog.Hash      `json:"hash"`
+	Proof tlog.TreeProof `json:"proof"`
+}
+
+// ErrNoMisbehavior is returned by Evidence.Verify for evidence of
+// two tree heads that are consistent after all.
+var ErrNoMisbehavior = errors.New("evidence does not show misbehavior: trees are consistent")
+
+// Verify checks that e proves misbehavior by the server with the given
+// verifiers: both notes must be signed by the server, and the proof must
+// show that the newer tree's hash for the older tree's records differs
+// from the older tree's hash.
+func (e *Evidence) Verify(verifiers note.Verifiers) error {
+	older, err := e.openTree(e.OlderNote, e.OlderSize, verifiers)
+	if err != nil {
+		return fmt.Errorf("older tree: %w", err)
+	}
+	newer, err := e.openTree(e.NewerNote, e.NewerSize, verifiers)
+	if err != nil {
+		return fmt.Errorf("newer tree: %w", err)
+	}
+	if older.N > newer.N {
+		return fmt.Errorf("older tree#%d is larger than newer tree#%d", older.N, newer.N)
+	}
+	if err := tlog.CheckTree(e.Proof, newer.N, newer.Hash, older.N, e.Hash); err != nil {
+		return fmt.Errorf("checking tree#%d against tree#%d: %v", older.N, newer.N, err)
+	}
+	if e.Hash == older.Hash {
+		return ErrNoMisbehavior
+	}
+	return nil
+}
+
+// openTree verifies the signed note msg and returns its tree,
+// which must have the given size.
+func (e *Evidence) openTree(msg string, size int64, verifiers note.Verifiers) (tlog.Tree, error) {
+	n, err := note.Open([]byte(msg), verifiers)
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+	tree, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+	if tree.N != size {
+		return tlog.Tree{}, fmt.Errorf("note has tree#%d, not tree#%d", tree.N, size)
+	}
+	return tree, nil
+}
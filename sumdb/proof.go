@@ -0,0 +1,255 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+// The proof endpoints let a client check a record or the consistency of
+// two trees with a single request instead of reading tiles:
+//
+//	/proof/record?id=N&tree=T  proves that record N is in the tree of size T
+//	/proof/tree?old=N&new=T    proves that the tree of size N is a prefix
+//	                           of the tree of size T
+//
+// They return the hashes of the tlog.RecordProof or tlog.TreeProof,
+// in order, each encoded in standard base64 on a line of its own.
+
+// proofTileHeight is the height of the tiles a Server reads
+// to compute proofs.
+const proofTileHeight = 8
+
+// formatProof returns the encoding of a proof served by the proof endpoints.
+func formatProof(p []tlog.Hash) []byte {
+	var buf bytes.Buffer
+	for _, h := range p {
+		buf.WriteString(base64.StdEncoding.EncodeToString(h[:]))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// parseProof parses a proof served by the proof endpoints.
+func parseProof(data []byte) ([]tlog.Hash, error) {
+	var p []tlog.Hash
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			return nil, fmt.Errorf("malformed proof: unterminated line")
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(line, "\n"))
+		if err != nil || len(b) != tlog.HashSize {
+			return nil, fmt.Errorf("malformed proof: invalid hash %q", strings.TrimSuffix(line, "\n"))
+		}
+		var h tlog.Hash
+		copy(h[:], b)
+		p = append(p, h)
+	}
+	return p, nil
+}
+
+// serveProof serves the proof endpoints.
+func (s *Server) serveProof(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	arg := func(name string) int64 {
+		n, err := strconv.ParseInt(q.Get(name), 10, 64)
+		if err != nil || n < 0 {
+			return -1
+		}
+		return n
+	}
+	size, err := s.treeSize(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hr := &opsHashReader{ctx: ctx, ops: s.ops}
+
+	var p []tlog.Hash
+	switch r.URL.Path {
+	default:
+		http.NotFound(w, r)
+		return
+
+	case "/proof/record":
+		id, tree := arg("id"), arg("tree")
+		if id < 0 || tree <= id {
+			http.Error(w, "invalid record proof request", http.StatusBadRequest)
+			return
+		}
+		if tree > size {
+			http.NotFound(w, r)
+			return
+		}
+		p, err = tlog.ProveRecord(tree, id, hr)
+
+	case "/proof/tree":
+		old, tree := arg("old"), arg("new")
+		if old < 1 || tree < old {
+			http.Error(w, "invalid tree proof request", http.StatusBadRequest)
+			return
+		}
+		if tree > size {
+			http.NotFound(w, r)
+			return
+		}
+		p, err = tlog.ProveTree(tree, old, hr)
+	}
+	if err == nil {
+		err = hr.err
+	}
+	if err != nil {
+		reportError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Write(formatProof(p))
+}
+
+// treeSize returns the size of the server's latest signed tree.
+func (s *Server) treeSize(ctx context.Context) (int64, error) {
+	msg, err := s.ops.Signed(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// The note was signed by the server itself,
+	// so its text can be used without verifying it.
+	i := bytes.Index(msg, []byte("\n\n"))
+	if i < 0 {
+		return 0, fmt.Errorf("malformed signed tree")
+	}
+	tree, err := tlog.ParseTree(msg[:i+1])
+	if err != nil {
+		return 0, err
+	}
+	return tree.N, nil
+}
+
+// An opsHashReader reads stored hashes from the hash tiles of a ServerOps.
+// It records the first error from ReadTileData, which the tlog proof
+// functions may not return unwrapped, so that it is reported as is.
+type opsHashReader struct {
+	ctx   context.Context
+	ops   ServerOps
+	tiles map[tlog.Tile][]byte
+	err   error
+}
+
+func (r *opsHashReader) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	if r.tiles == nil {
+		r.tiles = make(map[tlog.Tile][]byte)
+	}
+	list := make([]tlog.Hash, len(indexes))
+	for i, x := range indexes {
+		t := tlog.TileForIndex(proofTileHeight, x)
+		data, ok := r.tiles[t]
+		if !ok {
+			var err error
+			data, err = r.ops.ReadTileData(r.ctx, t)
+			if err != nil {
+				if r.err == nil {
+					r.err = err
+				}
+				return nil, err
+			}
+			r.tiles[t] = data
+		}
+		h, err := tlog.HashFromTile(t, data, x)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = h
+	}
+	return list, nil
+}
+
+// readProof reads the proof served at path with the given query.
+func (c *Client) readProof(r *tileReader, path string, query url.Values) ([]tlog.Hash, error) {
+	data, err := c.readRemote(r.ctx, path, query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	return parseProof(data)
+}
+
+// readRecordProof reads the server's proof that record id
+// is in the tree of size n.
+func (c *Client) readRecordProof(r *tileReader, id, n int64) ([]tlog.Hash, error) {
+	return c.readProof(r, "/proof/record", url.Values{
+		"id":   {strconv.FormatInt(id, 10)},
+		"tree": {strconv.FormatInt(n, 10)},
+	})
+}
+
+// checkRecordProof is checkRecord for proof mode.
+func (c *Client) checkRecordProof(r *tileReader, latest tlog.Tree, id int64, data []byte) error {
+	p, err := c.readRecordProof(r, id, latest.N)
+	if err != nil {
+		return err
+	}
+	if err := tlog.CheckRecord(p, latest.N, latest.Hash, id, tlog.RecordHash(data)); err != nil {
+		return fmt.Errorf("cannot authenticate record data in server response: %v", err)
+	}
+	return nil
+}
+
+// checkTreesProof is checkTrees for proof mode.
+func (c *Client) checkTreesProof(r *tileReader, older tlog.Tree, olderNote []byte, newer tlog.Tree, newerNote []byte) error {
+	switch {
+	case older.N == 0:
+		if older.Hash == (tlog.Hash{}) {
+			return nil
+		}
+	case older.N == newer.N:
+		if older.Hash == newer.Hash {
+			return nil
+		}
+	default:
+		p, err := c.readProof(r, "/proof/tree", url.Values{
+			"old": {strconv.FormatInt(older.N, 10)},
+			"new": {strconv.FormatInt(newer.N, 10)},
+		})
+		if err != nil {
+			return fmt.Errorf("checking tree#%d against tree#%d: %w", older.N, newer.N, err)
+		}
+		if tlog.CheckTree(p, newer.N, newer.Hash, older.N, older.Hash) == nil {
+			return nil
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "SECURITY ERROR\n")
+	fmt.Fprintf(&buf, "go.sum database server misbehavior detected!\n\n")
+	indent := func(b []byte) []byte {
+		return bytes.Replace(b, []byte("\n"), []byte("\n\t"), -1)
+	}
+	fmt.Fprintf(&buf, "old database:\n\t%s\n", indent(olderNote))
+	fmt.Fprintf(&buf, "new database:\n\t%s\n", indent(newerNote))
+	if older.N == newer.N {
+		// Two different hashes for one tree size need no further proof.
+		if ops, ok := c.ops.(EvidenceClientOps); ok {
+			ops.SecurityEvidence(&Evidence{
+				OlderNote: string(olderNote),
+				NewerNote: string(newerNote),
+				OlderSize: older.N,
+				NewerSize: newer.N,
+				Hash:      newer.Hash,
+			})
+		}
+	} else {
+		fmt.Fprintf(&buf, "the server's proof that the old tree is contained in the new tree does not verify\n")
+	}
+	c.ops.SecurityError(buf.String())
+	return ErrSecurity
+}
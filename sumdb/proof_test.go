@@ -0,0 +1,106 @@
+package sumdb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+func TestServerProof(t *testing.T) {
+	ctx := context.Background()
+	ts := NewTestServer(testSignerKey, func(path, vers string) ([]byte, error) {
+		return []byte(path + " " + vers + " h1:hash=\n"), nil
+	})
+	for i := 0; i < 300; i++ {
+		if _, err := ts.Lookup(ctx, fmt.Sprintf("example.com/%d@v1", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(NewServer(ts))
+	defer srv.Close()
+
+	get := func(path string) ([]byte, int) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data, resp.StatusCode
+	}
+	tree := func(n int64) tlog.Tree {
+		h, err := tlog.TreeHash(n, &opsHashReader{ctx: ctx, ops: ts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tlog.Tree{N: n, Hash: h}
+	}
+
+	msg, err := ts.Signed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(testVerifierKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := note.Open(msg, note.VerifierList(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := tlog.ParseTree([]byte(n.Text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, code := get("/proof/record?id=123&tree=300")
+	if code != http.StatusOK {
+		t.Fatalf("/proof/record: %d %s", code, data)
+	}
+	p, err := parseProof(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ts.ReadRecords(ctx, 123, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tlog.CheckRecord(p, latest.N, latest.Hash, 123, tlog.RecordHash(records[0])); err != nil {
+		t.Fatalf("record proof: %v", err)
+	}
+
+	old := tree(100)
+	data, code = get("/proof/tree?old=100&new=300")
+	if code != http.StatusOK {
+		t.Fatalf("/proof/tree: %d %s", code, data)
+	}
+	if p, err = parseProof(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tlog.CheckTree(p, latest.N, latest.Hash, old.N, old.Hash); err != nil {
+		t.Fatalf("tree proof: %v", err)
+	}
+
+	for path, want := range map[string]int{
+		"/proof/record?id=300&tree=300": http.StatusBadRequest,
+		"/proof/record?id=1":            http.StatusBadRequest,
+		"/proof/tree?old=0&new=300":     http.StatusBadRequest,
+		"/proof/tree?old=200&new=100":   http.StatusBadRequest,
+		"/proof/record?id=1&tree=301":   http.StatusNotFound,
+		"/proof/tree?old=100&new=400":   http.StatusNotFound,
+		"/proof/other":                  http.StatusNotFound,
+	} {
+		if _, code := get(path); code != want {
+			t.Errorf("%s: status %d, want %d", path, code, want)
+		}
+	}
+}
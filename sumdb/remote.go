@@ -0,0 +1,79 @@
+package sumdb
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+// A Remote reads from a log server, for tools such as auditors and
+// mirrors that read tiles and tree heads without a Client.
+// It is implemented by ContextClientOps.
+type Remote interface {
+	ReadRemoteContext(ctx context.Context, path, query string) ([]byte, error)
+}
+
+// NewRemote returns a Remote reading from the log server at serverURL
+// over HTTP. It reports a non-200 response as a *RemoteError.
+func NewRemote(serverURL string) Remote {
+	return &httpRemote{serverURL: serverURL}
+}
+
+type httpRemote struct {
+	serverURL string
+}
+
+func (r *httpRemote) ReadRemoteContext(ctx context.Context, path, query string) ([]byte, error) {
+	u, err := url.Parse(r.serverURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	u.RawQuery = query
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := &RemoteError{Path: path, StatusCode: resp.StatusCode, Status: resp.Status}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, e
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// ReadRemoteTile reads the tile t from remote. If t is a partial tile
+// that the server no longer serves, because the log has since filled it,
+// ReadRemoteTile reads the full tile instead. It returns a full hash tile
+// cut to the width of t, but a full record data tile (t.L == -1) as is,
+// for the caller to read only its first t.W records. If neither tile
+// can be read, it returns the error for t.
+func ReadRemoteTile(ctx context.Context, remote Remote, t tlog.Tile) ([]byte, error) {
+	data, err := remote.ReadRemoteContext(ctx, "/"+t.Path(), "")
+	if err == nil || t.W == 1<<uint(t.H) {
+		return data, err
+	}
+	full := t
+	full.W = 1 << uint(t.H)
+	fdata, ferr := remote.ReadRemoteContext(ctx, "/"+full.Path(), "")
+	if ferr != nil {
+		return nil, err
+	}
+	if t.L >= 0 && len(fdata) >= t.W*tlog.HashSize {
+		fdata = fdata[:t.W*tlog.HashSize]
+	}
+	return fdata, nil
+}
@@ -0,0 +1,51 @@
+package sumdb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+// mapRemote is a Remote serving the contents of a map, keyed by path.
+type mapRemote map[string][]byte
+
+func (m mapRemote) ReadRemoteContext(ctx context.Context, path, query string) ([]byte, error) {
+	if data, ok := m[path]; ok {
+		return data, nil
+	}
+	return nil, &RemoteError{Path: path, StatusCode: 404, Status: "404 Not Found"}
+}
+
+func TestReadRemoteTile(t *testing.T) {
+	ctx := context.Background()
+	full := tlog.Tile{H: 2, L: 0, N: 0, W: 4}
+	hashes := bytes.Repeat([]byte{1}, 4*tlog.HashSize)
+	records := []byte("record data")
+	data := full
+	data.L = -1
+	remote := mapRemote{"/" + full.Path(): hashes, "/" + data.Path(): records}
+
+	// A partial hash tile is cut from the full tile.
+	partial := full
+	partial.W = 3
+	got, err := ReadRemoteTile(ctx, remote, partial)
+	if err != nil || !bytes.Equal(got, hashes[:3*tlog.HashSize]) {
+		t.Fatalf("ReadRemoteTile(%v) = %d bytes, %v, want %d bytes", partial.Path(), len(got), err, 3*tlog.HashSize)
+	}
+
+	// A partial data tile is read from the full one, in full.
+	partial = data
+	partial.W = 3
+	if got, err := ReadRemoteTile(ctx, remote, partial); err != nil || !bytes.Equal(got, records) {
+		t.Fatalf("ReadRemoteTile(%v) = %q, %v, want %q", partial.Path(), got, err, records)
+	}
+
+	// Missing tiles report the error for the requested tile.
+	missing := tlog.Tile{H: 2, L: 0, N: 1, W: 2}
+	_, err = ReadRemoteTile(ctx, remote, missing)
+	if e, ok := err.(*RemoteError); !ok || e.Path != "/"+missing.Path() {
+		t.Fatalf("ReadRemoteTile of missing tile: err = %v", err)
+	}
+}
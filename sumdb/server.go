@@ -9,10 +9,13 @@ package sumdb
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.transparencylog.com/mod/sumdb/tlog"
 )
@@ -27,7 +30,8 @@ type ServerOps interface {
 	ReadRecords(ctx context.Context, id, n int64) ([][]byte, error)
 
 	// Lookup looks up a record for the given key,
-	// returning the record ID.
+	// returning the record ID. If the record is waiting
+	// to be added to the tree, it returns a *PendingError.
 	Lookup(ctx context.Context, key string) (int64, error)
 
 	// ReadTileData reads the content of tile t.
@@ -35,6 +39,19 @@ type ServerOps interface {
 	ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error)
 }
 
+// A DigestServerOps is a ServerOps that can also use the digest a client
+// expects, sent as the "h" query parameter of a lookup. If the ServerOps
+// passed to NewServer implements DigestServerOps, the Server uses
+// LookupDigest instead of Lookup when a lookup has an "h" parameter.
+type DigestServerOps interface {
+	ServerOps
+
+	// LookupDigest is like Lookup, but if the record for key
+	// does not hold digest, it may check whether the content
+	// has changed and return the ID of a newer record.
+	LookupDigest(ctx context.Context, key, digest string) (int64, error)
+}
+
 // A Server is the checksum database HTTP server,
 // which implements http.Handler and should be invoked
 // to serve the paths listed in ServerPaths.
@@ -60,6 +77,7 @@ var ServerPaths = []string{
 	"/lookup/",
 	"/latest",
 	"/tile/",
+	"/proof/",
 }
 
 var modVerRE = regexp.MustCompile(`^[^@]+@v[0-9]+\.[0-9]+\.[0-9]+(-[^@]*)?(\+incompatible)?$`)
@@ -73,7 +91,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	case strings.HasPrefix(r.URL.Path, "/lookup/"):
 		key := strings.TrimPrefix(r.URL.Path, "/lookup/")
-		id, err := s.ops.Lookup(ctx, key)
+		var id int64
+		var err error
+		if ops, ok := s.ops.(DigestServerOps); ok && r.URL.Query().Get("h") != "" {
+			id, err = ops.LookupDigest(ctx, key, r.URL.Query().Get("h"))
+		} else {
+			id, err = s.ops.Lookup(ctx, key)
+		}
 		if err != nil {
 			reportError(w, r, err)
 			return
@@ -102,6 +126,9 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Write(msg)
 		w.Write(signed)
 
+	case strings.HasPrefix(r.URL.Path, "/proof/"):
+		s.serveProof(w, r)
+
 	case r.URL.Path == "/latest":
 		data, err := s.ops.Signed(ctx)
 		if err != nil {
@@ -154,13 +181,32 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // reportError reports err to w.
 // If it's a not-found, the reported error is 404.
+// If it wraps ErrRefused or ErrRateLimited, it is 403 or 429.
 // Otherwise it is an internal server error.
 // The caller must only call reportError in contexts where
 // a not-found err should be reported as 404.
 func reportError(w http.ResponseWriter, r *http.Request, err error) {
-	if os.IsNotExist(err) {
+	var pe *PendingError
+	switch {
+	case errors.As(err, &pe):
+		// Retry-After is in whole seconds; round up so that
+		// the client does not retry before the record is added.
+		secs := int64((pe.RetryAfter + time.Second - 1) / time.Second)
+		if secs < 1 {
+			secs = 1
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case os.IsNotExist(err):
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
+	case errors.Is(err, ErrRefused):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, ErrRateLimited):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
 	}
 	http.Error(w, err.Error(), http.StatusInternalServerError)
 }
@@ -0,0 +1,31 @@
+// Package sumdbtest provides in-memory access to log servers for tests.
+package sumdbtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"go.transparencylog.com/tl/sumdb"
+)
+
+// NewRemote returns a sumdb.Remote that reads from h in memory,
+// such as a sumdb.Server for a sumdb.TestServer. It reports a non-200
+// response as a *sumdb.RemoteError, as the Remote returned by
+// sumdb.NewRemote does.
+func NewRemote(h http.Handler) sumdb.Remote {
+	return remote{h}
+}
+
+type remote struct {
+	h http.Handler
+}
+
+func (r remote) ReadRemoteContext(ctx context.Context, path, query string) ([]byte, error) {
+	w := httptest.NewRecorder()
+	r.h.ServeHTTP(w, httptest.NewRequest("GET", path+"?"+query, nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		return nil, &sumdb.RemoteError{Path: path, StatusCode: w.Code, Status: http.StatusText(w.Code)}
+	}
+	return w.Body.Bytes(), nil
+}
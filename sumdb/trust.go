@@ -0,0 +1,198 @@
+package sumdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/note"
+)
+
+// A TrustedKey is a verifier key of the log
+// along with the times between which it may sign tree heads.
+// A zero NotBefore or NotAfter leaves that end of the window open.
+type TrustedKey struct {
+	Key       string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// ValidAt reports whether k may sign tree heads at time t.
+func (k TrustedKey) ValidAt(t time.Time) bool {
+	return (k.NotBefore.IsZero() || !t.Before(k.NotBefore)) &&
+		(k.NotAfter.IsZero() || t.Before(k.NotAfter))
+}
+
+// String returns k as a line of a trust configuration.
+func (k TrustedKey) String() string {
+	s := k.Key
+	if !k.NotBefore.IsZero() {
+		s += " not-before=" + k.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if !k.NotAfter.IsZero() {
+		s += " not-after=" + k.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return s
+}
+
+// ParseTrust parses a trust configuration, which the Client reads
+// as its "key" configuration file. Each non-blank line not starting
+// with # holds a verifier key of the log, optionally followed by
+// not-before=TIME and not-after=TIME with times in RFC 3339 format.
+// A configuration holding just a verifier key, as written by earlier
+// versions, trusts that key at all times. All keys must have the same
+// name, the name of the log.
+func ParseTrust(data []byte) ([]TrustedKey, error) {
+	var keys []TrustedKey
+	for i, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		k, err := parseTrustedKey(f)
+		if err != nil {
+			return nil, fmt.Errorf("trust line %d: %v", i+1, err)
+		}
+		if len(keys) > 0 {
+			if name, first := keyName(k.Key), keyName(keys[0].Key); name != first {
+				return nil, fmt.Errorf("trust line %d: key name %s differs from %s", i+1, name, first)
+			}
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no trusted log keys")
+	}
+	return keys, nil
+}
+
+// FormatTrust formats keys as a trust configuration.
+func FormatTrust(keys []TrustedKey) []byte {
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s\n", k)
+	}
+	return buf.Bytes()
+}
+
+// parseTrustedKey parses the fields of a trust configuration line.
+func parseTrustedKey(f []string) (TrustedKey, error) {
+	if len(f) == 0 {
+		return TrustedKey{}, errors.New("missing key")
+	}
+	k := TrustedKey{Key: f[0]}
+	if _, err := note.NewVerifier(k.Key); err != nil {
+		return TrustedKey{}, err
+	}
+	for _, opt := range f[1:] {
+		i := strings.Index(opt, "=")
+		if i < 0 {
+			return TrustedKey{}, fmt.Errorf("invalid option %q", opt)
+		}
+		t, err := time.Parse(time.RFC3339, opt[i+1:])
+		if err != nil {
+			return TrustedKey{}, fmt.Errorf("invalid time in %q", opt)
+		}
+		switch opt[:i] {
+		case "not-before":
+			k.NotBefore = t
+		case "not-after":
+			k.NotAfter = t
+		default:
+			return TrustedKey{}, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+	return k, nil
+}
+
+// SigningKey opens the signed tree head msg with the trusted keys and
+// returns the note and the trusted key that signed it. It does not check
+// the key's validity window, which depends on when msg was signed.
+func SigningKey(msg []byte, trusted []TrustedKey) (*note.Note, TrustedKey, error) {
+	var list []note.Verifier
+	for _, k := range trusted {
+		v, err := note.NewVerifier(k.Key)
+		if err != nil {
+			return nil, TrustedKey{}, err
+		}
+		list = append(list, v)
+	}
+	n, err := note.Open(msg, note.VerifierList(list...))
+	if err != nil {
+		return nil, TrustedKey{}, err
+	}
+	for _, sig := range n.Sigs {
+		for i, v := range list {
+			if v.Name() == sig.Name && v.KeyHash() == sig.Hash {
+				return n, trusted[i], nil
+			}
+		}
+	}
+	// note.Open only succeeds with a signature by one of the verifiers.
+	return nil, TrustedKey{}, errors.New("internal error: no trusted signature")
+}
+
+// keyName returns the name of the verifier key vkey.
+func keyName(vkey string) string {
+	if i := strings.Index(vkey, "+"); i >= 0 {
+		return vkey[:i]
+	}
+	return vkey
+}
+
+// rotationHeader is the first line of the text of a rotation statement.
+const rotationHeader = "tl log key rotation\n"
+
+// SignRotation returns a rotation statement, signed by signer, the log's
+// current key, introducing k as a key of the log. The key must have the
+// same name as signer.
+func SignRotation(signer note.Signer, k TrustedKey) ([]byte, error) {
+	if _, err := parseTrustedKey(strings.Fields(k.String())); err != nil {
+		return nil, err
+	}
+	if name := keyName(k.Key); name != signer.Name() {
+		return nil, fmt.Errorf("new key name %s differs from signer name %s", name, signer.Name())
+	}
+	return note.Sign(&note.Note{Text: rotationHeader + k.String() + "\n"}, signer)
+}
+
+// OpenRotation verifies the rotation statement msg and returns the key
+// it introduces. The statement must be signed by one of the trusted keys
+// that is valid at time now.
+func OpenRotation(msg []byte, trusted []TrustedKey, now time.Time) (TrustedKey, error) {
+	var list []note.Verifier
+	for _, k := range trusted {
+		if !k.ValidAt(now) {
+			continue
+		}
+		v, err := note.NewVerifier(k.Key)
+		if err != nil {
+			return TrustedKey{}, err
+		}
+		list = append(list, v)
+	}
+	if len(list) == 0 {
+		return TrustedKey{}, errors.New("no currently valid trusted log key")
+	}
+	n, err := note.Open(msg, note.VerifierList(list...))
+	if err != nil {
+		return TrustedKey{}, fmt.Errorf("reading rotation statement: %w", err)
+	}
+	if !strings.HasPrefix(n.Text, rotationHeader) {
+		return TrustedKey{}, errors.New("not a log key rotation statement")
+	}
+	line := strings.TrimSuffix(strings.TrimPrefix(n.Text, rotationHeader), "\n")
+	if strings.Contains(line, "\n") {
+		return TrustedKey{}, errors.New("malformed rotation statement")
+	}
+	k, err := parseTrustedKey(strings.Fields(line))
+	if err != nil {
+		return TrustedKey{}, fmt.Errorf("rotation statement: %v", err)
+	}
+	if name := keyName(k.Key); name != list[0].Name() {
+		return TrustedKey{}, fmt.Errorf("rotation statement introduces key for %s, not %s", name, list[0].Name())
+	}
+	return k, nil
+}
@@ -0,0 +1,85 @@
+package sumdb
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"go.transparencylog.com/mod/sumdb/note"
+)
+
+func TestTrust(t *testing.T) {
+	_, other, err := note.GenerateKey(rand.Reader, "other.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{testVerifierKey, ""},
+		{"# comment\n\n" + testVerifierKey + " not-before=2020-01-01T00:00:00Z not-after=2021-01-01T00:00:00Z\n", ""},
+		{"", "no trusted log keys"},
+		{"bad-key", "malformed verifier id"},
+		{testVerifierKey + " not-before=yesterday", "invalid time"},
+		{testVerifierKey + " expires=2020-01-01T00:00:00Z", "unknown option"},
+		{testVerifierKey + "\n" + other, "differs from"},
+	} {
+		keys, err := ParseTrust([]byte(tt.data))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseTrust(%q): err = %v, want %q", tt.data, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTrust(%q): %v", tt.data, err)
+			continue
+		}
+		again, err := ParseTrust(FormatTrust(keys))
+		if err != nil || len(again) != len(keys) || again[0] != keys[0] {
+			t.Errorf("ParseTrust(FormatTrust(%v)) = %v, %v", keys, again, err)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	signer, err := note.NewSigner(testSignerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, vkey, err := note.GenerateKey(rand.Reader, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	trusted := []TrustedKey{{Key: testVerifierKey, NotAfter: notAfter}}
+	newKey := TrustedKey{Key: vkey, NotBefore: notAfter.Add(-time.Hour)}
+
+	msg, err := SignRotation(signer, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := OpenRotation(msg, trusted, notAfter.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Key != newKey.Key || !k.NotBefore.Equal(newKey.NotBefore) {
+		t.Fatalf("OpenRotation = %v, want %v", k, newKey)
+	}
+
+	// A statement signed by an expired key is rejected.
+	if _, err := OpenRotation(msg, trusted, notAfter); err == nil {
+		t.Fatal("OpenRotation with expired key succeeded")
+	}
+
+	// Keys for another log cannot be introduced.
+	_, other, err := note.GenerateKey(rand.Reader, "other.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignRotation(signer, TrustedKey{Key: other}); err == nil {
+		t.Fatal("SignRotation of key for another log succeeded")
+	}
+}
@@ -0,0 +1,83 @@
+package sumdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.transparencylog.com/mod/sumdb/note"
+)
+
+// ErrNoTree is returned by Witness.Cosigned before the witness
+// has checked any tree head.
+var ErrNoTree = errors.New("no tree head checked yet")
+
+// A Witness checks that the tree heads published by a log form a single
+// consistent history and cosigns the heads it has checked.
+//
+// The Witness uses a Client for the checks, so its ClientOps provide
+// the log's verifier key and persist, as the "latest" configuration
+// file, the latest tree head the Witness has checked. A tree head that
+// is not consistent with that history is reported with SecurityError
+// and never cosigned.
+type Witness struct {
+	client *Client
+	signer note.Signer
+}
+
+// NewWitness returns a new Witness using ops to reach the log
+// and signer to cosign its tree heads.
+func NewWitness(ops ClientOps, signer note.Signer) *Witness {
+	return &Witness{
+		client: NewClient(ops),
+		signer: signer,
+	}
+}
+
+// Update fetches the log's latest tree head and checks that it is
+// consistent with the history the witness has already checked,
+// making it the witness's latest tree head if it is newer.
+func (w *Witness) Update(ctx context.Context) error {
+	msg, err := w.client.FetchLatest(ctx)
+	if err != nil {
+		return err
+	}
+	return w.client.MergeLatest(ctx, msg)
+}
+
+// Cosigned returns the latest tree head checked by the witness
+// as a signed note carrying the log's signature, any other signatures
+// it was published with, and the witness's own cosignature.
+func (w *Witness) Cosigned() ([]byte, error) {
+	tree, msg, err := w.client.LoadLatest(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if tree.N == 0 {
+		return nil, ErrNoTree
+	}
+	n, err := note.Open(msg, w.client.verifiers)
+	if err != nil {
+		return nil, err
+	}
+	return note.Sign(n, w.signer)
+}
+
+// ServeHTTP serves the cosigned latest tree head at /latest.
+func (w *Witness) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/latest" {
+		http.NotFound(rw, req)
+		return
+	}
+	msg, err := w.Cosigned()
+	if errors.Is(err, ErrNoTree) {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	rw.Write(msg)
+}
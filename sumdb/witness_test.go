@@ -0,0 +1,82 @@
+package sumdb
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"go.transparencylog.com/mod/sumdb/note"
+	"go.transparencylog.com/mod/sumdb/tlog"
+)
+
+func TestWitness(t *testing.T) {
+	tc := newTestClient(t)
+	tc.config[testName+"/latest"] = nil
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "witness.localdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logVerifier, err := note.NewVerifier(testVerifierKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWitness(tc, signer)
+	w.client.SetTileHeight(tc.tileHeight)
+	if _, err := w.Cosigned(); !errors.Is(err, ErrNoTree) {
+		t.Fatalf("Cosigned before Update: err = %v, want ErrNoTree", err)
+	}
+
+	// The witness cosigns the log's latest tree head.
+	tc.remote["/latest"] = tc.signTree(tc.treeSize)
+	if err := w.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := w.Cosigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := note.Open(msg, note.VerifierList(logVerifier, verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Sigs) != 2 {
+		t.Fatalf("cosigned note has %d verified signatures, want 2:\n%s", len(n.Sigs), msg)
+	}
+	tc.mustHaveLatest(4)
+
+	// A fork is reported and never cosigned.
+	tc2 := tc.fork()
+	tc.addRecord("rsc.io/pkg1@v1.5.2", "rsc.io/pkg1 v1.5.2 h1:hash!=\n")
+	tc.remote["/latest"] = tc.signTree(tc.treeSize)
+	if err := w.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tc2.addRecord("rsc.io/pkg1@v1.5.3", "rsc.io/pkg1 v1.5.3 h1:hash!=\n")
+	tc.remote["/latest"] = tc2.signTree(tc2.treeSize)
+	err = w.Update(context.Background())
+	if !errors.Is(err, ErrSecurity) {
+		t.Fatalf("Update with forked tree: err = %v, want ErrSecurity", err)
+	}
+	msg, err = w.Cosigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = note.Open(msg, note.VerifierList(logVerifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree, err := tlog.ParseTree([]byte(n.Text)); err != nil || tree.N != 5 {
+		t.Fatalf("cosigned tree after fork = %v, %v, want tree 5", tree, err)
+	}
+}